@@ -0,0 +1,51 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/wgawan/agent-spy/internal/api"
+)
+
+// runExport implements `agent-spy export`, which fetches data from a running
+// session through its API server.
+func runExport(args []string) int {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	patch := fs.Bool("patch", false, "export the net session changes as a git-apply patch")
+	addr := fs.String("addr", "", "API address of the running session (its -listen value)")
+	output := fs.String("o", "", "write to this file instead of stdout")
+	filter := fs.String("filter", "", "only include paths containing this text")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: agent-spy export --patch --addr <host:port|unix:path> [flags]\n\n")
+		fmt.Fprintf(os.Stderr, "Export data from a session started with -listen.\n\n")
+		fmt.Fprintf(os.Stderr, "Flags:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if !*patch {
+		fmt.Fprintf(os.Stderr, "Error: nothing to export (use --patch)\n")
+		return 2
+	}
+	if *addr == "" {
+		fmt.Fprintf(os.Stderr, "Error: --addr is required\n")
+		return 2
+	}
+
+	text, err := api.NewClient(*addr).Patch(*filter)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error exporting patch: %v\n", err)
+		return 1
+	}
+
+	if *output == "" {
+		fmt.Print(text)
+		return 0
+	}
+	if err := os.WriteFile(*output, []byte(text), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing %s: %v\n", *output, err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,407 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wgawan/agent-spy/internal/bus"
+	"github.com/wgawan/agent-spy/internal/store"
+	"github.com/wgawan/agent-spy/internal/types"
+)
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+	keepAlive       = 15 * time.Second
+	streamBuffer    = 64
+)
+
+type Config struct {
+	Store     *store.Store
+	Bus       *bus.Bus
+	WatchPath string
+	GitBranch string
+	// Branch reports the current branch, which git operations may change;
+	// nil uses GitBranch.
+	Branch func() string
+	// Patch builds the session patch; nil when git is unavailable.
+	Patch func(include func(path string) bool) (string, error)
+	// Pause pauses and resumes event capture; nil disables /pause and
+	// /resume.
+	Pause Pauser
+}
+
+// Pauser pauses and resumes event capture.
+type Pauser interface {
+	Paused() bool
+	SetPaused(paused bool)
+}
+
+// Server exposes the event store over HTTP:
+//
+//	GET /events            paged event history (?offset=N&limit=N)
+//	GET /events/{id}/diff  the diff recorded for an event
+//	GET /stats             session totals, as shown in the stats bar
+//	GET /changesets        events grouped into bursts of activity, with
+//	                       their combined totals
+//	GET /stream            Server-Sent Events stream of new events, sent
+//	                       once their diff is ready
+//	GET /metrics           per-subscriber delivery and drop counters
+//	GET /patch             net session changes as a git-apply patch
+//	                       (?path=substr limits it to matching paths)
+//	POST /pause            stop recording events until resumed
+//	POST /resume           resume recording
+//
+// POST requests are refused if they could have come from a web page: see
+// allowPost.
+type Server struct {
+	config Config
+	srv    *http.Server
+}
+
+// eventSummary is the wire form of a record without its hunks; the full
+// diff is fetched separately from /events/{id}/diff.
+type eventSummary struct {
+	ID int `json:"id"`
+	types.FileEvent
+	Pending    bool             `json:"pending,omitempty"`
+	BeforeHash string           `json:"before_hash,omitempty"`
+	AfterHash  string           `json:"after_hash,omitempty"`
+	Stats      *types.DiffStats `json:"stats,omitempty"`
+	ChangeSet  int              `json:"change_set,omitempty"`
+}
+
+type eventsPage struct {
+	Total  int            `json:"total"`
+	Offset int            `json:"offset"`
+	Limit  int            `json:"limit"`
+	Events []eventSummary `json:"events"`
+}
+
+type statsResponse struct {
+	store.Stats
+	ElapsedSeconds int    `json:"elapsed_seconds"`
+	WatchPath      string `json:"watch_path"`
+	GitBranch      string `json:"git_branch,omitempty"`
+	Paused         bool   `json:"paused,omitempty"`
+}
+
+type pauseResponse struct {
+	Paused bool `json:"paused"`
+}
+
+func New(cfg Config) *Server {
+	s := &Server{config: cfg}
+	s.srv = &http.Server{Handler: s.Handler()}
+	return s
+}
+
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/events", s.handleEvents)
+	mux.HandleFunc("/events/", s.handleEventDiff)
+	mux.HandleFunc("/stats", s.handleStats)
+	mux.HandleFunc("/changesets", s.handleChangeSets)
+	mux.HandleFunc("/stream", s.handleStream)
+	mux.HandleFunc("/metrics", s.handleMetrics)
+	mux.HandleFunc("/patch", s.handlePatch)
+	mux.HandleFunc("/pause", s.handlePause(true))
+	mux.HandleFunc("/resume", s.handlePause(false))
+	return mux
+}
+
+// Serve accepts connections on l until Close is called.
+func (s *Server) Serve(l net.Listener) error {
+	err := s.srv.Serve(l)
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+func (s *Server) Close() error {
+	return s.srv.Close()
+}
+
+// Listen opens a listener for addr, which is either a TCP address such as
+// "127.0.0.1:7777" or a unix socket path prefixed with "unix:".
+func Listen(addr string) (net.Listener, error) {
+	if path := strings.TrimPrefix(addr, "unix:"); path != addr {
+		// Remove a stale socket from a previous run, but nothing else.
+		if info, err := os.Lstat(path); err == nil {
+			if info.Mode()&os.ModeSocket == 0 {
+				return nil, fmt.Errorf("%s exists and is not a socket", path)
+			}
+			os.Remove(path)
+		}
+		return net.Listen("unix", path)
+	}
+	return net.Listen("tcp", addr)
+}
+
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+	q := r.URL.Query()
+	offset, err := intParam(q.Get("offset"), 0)
+	if err != nil || offset < 0 {
+		http.Error(w, "invalid offset", http.StatusBadRequest)
+		return
+	}
+	limit, err := intParam(q.Get("limit"), defaultPageSize)
+	if err != nil || limit <= 0 {
+		http.Error(w, "invalid limit", http.StatusBadRequest)
+		return
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+
+	page := eventsPage{
+		Total:  s.config.Store.Len(),
+		Offset: offset,
+		Limit:  limit,
+		Events: []eventSummary{},
+	}
+	for _, rec := range s.config.Store.Page(offset, limit) {
+		page.Events = append(page.Events, summarize(rec))
+	}
+	writeJSON(w, page)
+}
+
+func (s *Server) handleEventDiff(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+	rest := strings.TrimPrefix(r.URL.Path, "/events/")
+	idStr := strings.TrimSuffix(rest, "/diff")
+	if idStr == rest {
+		http.NotFound(w, r)
+		return
+	}
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.Error(w, "invalid event id", http.StatusBadRequest)
+		return
+	}
+	rec, ok := s.config.Store.Get(id)
+	if !ok {
+		http.Error(w, "event not found", http.StatusNotFound)
+		return
+	}
+	if rec.Pending {
+		// Diff still being computed; clients should retry shortly.
+		w.Header().Set("Retry-After", "1")
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	writeJSON(w, rec.Diff)
+}
+
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+	st := s.config.Store.Stats()
+	branch := s.config.GitBranch
+	if s.config.Branch != nil {
+		branch = s.config.Branch()
+	}
+	writeJSON(w, statsResponse{
+		Stats:          st,
+		ElapsedSeconds: int(time.Since(st.StartTime).Seconds()),
+		WatchPath:      s.config.WatchPath,
+		GitBranch:      branch,
+		Paused:         s.config.Pause != nil && s.config.Pause.Paused(),
+	})
+}
+
+// handlePause returns the handler that pauses or resumes capture.
+func (s *Server) handlePause(paused bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !allowPost(w, r) {
+			return
+		}
+		if s.config.Pause == nil {
+			http.Error(w, "pausing is not available", http.StatusNotImplemented)
+			return
+		}
+		s.config.Pause.SetPaused(paused)
+		writeJSON(w, pauseResponse{Paused: s.config.Pause.Paused()})
+	}
+}
+
+func (s *Server) handleChangeSets(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+	sets := s.config.Store.ChangeSets()
+	if sets == nil {
+		sets = []store.ChangeSet{}
+	}
+	writeJSON(w, sets)
+}
+
+func (s *Server) handleStream(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	// Stream clients sit behind the network; never let one stall the watcher.
+	sub := s.config.Bus.Subscribe("api:"+r.RemoteAddr, streamBuffer, bus.DropOldest)
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ping := time.NewTicker(keepAlive)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ping.C:
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		case rec, ok := <-sub.C():
+			if !ok {
+				return
+			}
+			if rec.Pending {
+				continue // announced once its diff is ready
+			}
+			data, err := json.Marshal(summarize(rec))
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "id: %d\nevent: file\ndata: %s\n\n", rec.ID, data)
+			flusher.Flush()
+		}
+	}
+}
+
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+	writeJSON(w, s.config.Bus.Metrics())
+}
+
+func (s *Server) handlePatch(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+	if s.config.Patch == nil {
+		http.Error(w, "patch export requires git", http.StatusNotImplemented)
+		return
+	}
+	var include func(string) bool
+	if filter := r.URL.Query().Get("path"); filter != "" {
+		include = func(path string) bool { return strings.Contains(path, filter) }
+	}
+	patch, err := s.config.Patch(include)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/x-patch; charset=utf-8")
+	fmt.Fprint(w, patch)
+}
+
+func summarize(rec types.Record) eventSummary {
+	sum := eventSummary{
+		ID:         rec.ID,
+		FileEvent:  rec.Event,
+		Pending:    rec.Pending,
+		BeforeHash: rec.BeforeHash,
+		AfterHash:  rec.AfterHash,
+		ChangeSet:  rec.ChangeSet,
+	}
+	if rec.Diff.Available {
+		stats := rec.Diff.Stats
+		sum.Stats = &stats
+	}
+	return sum
+}
+
+func allowGet(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	return true
+}
+
+// allowPost accepts a POST only if a web page in a local browser couldn't
+// have sent it: its Host must name the address it was received on, which
+// rules out DNS rebinding, and any Origin must be that same host.
+func allowPost(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	if !localHost(r) {
+		http.Error(w, "unexpected Host header", http.StatusForbidden)
+		return false
+	}
+	if origin := r.Header.Get("Origin"); origin != "" {
+		if u, err := url.Parse(origin); err != nil || u.Host != r.Host {
+			http.Error(w, "cross-origin requests are not allowed", http.StatusForbidden)
+			return false
+		}
+	}
+	return true
+}
+
+// localHost reports whether r's Host header names the TCP address the
+// request came in on, by IP or as localhost. Any Host will do over a unix
+// socket, which browsers can't reach.
+func localHost(r *http.Request) bool {
+	addr, ok := r.Context().Value(http.LocalAddrContextKey).(*net.TCPAddr)
+	if !ok {
+		return true
+	}
+	host, port, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host, port = r.Host, "80"
+	}
+	if port != strconv.Itoa(addr.Port) {
+		return false
+	}
+	if host == "localhost" {
+		return addr.IP.IsLoopback()
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.Equal(addr.IP)
+}
+
+func intParam(v string, def int) (int, error) {
+	if v == "" {
+		return def, nil
+	}
+	return strconv.Atoi(v)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,367 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wgawan/agent-spy/internal/bus"
+	"github.com/wgawan/agent-spy/internal/store"
+	"github.com/wgawan/agent-spy/internal/types"
+)
+
+type testEnv struct {
+	store *store.Store
+	bus   *bus.Bus
+}
+
+func newTestServer(t *testing.T) (*testEnv, *httptest.Server) {
+	t.Helper()
+	env := &testEnv{store: store.New(), bus: bus.New()}
+	srv := httptest.NewServer(New(Config{
+		Store:     env.store,
+		Bus:       env.bus,
+		WatchPath: "~/proj",
+		GitBranch: "main",
+	}).Handler())
+	t.Cleanup(srv.Close)
+	return env, srv
+}
+
+func addEvent(env *testEnv, path string) types.Record {
+	rec := env.store.Add(types.Record{
+		Event: types.FileEvent{Path: path, Op: types.OpModify, Timestamp: time.Now()},
+		Diff: types.DiffResult{
+			Available: true,
+			Hunks: []types.DiffHunk{{
+				Header: "@@ -1 +1 @@",
+				Lines:  []types.DiffLine{{Content: "hello", Type: types.DiffLineAdd}},
+			}},
+			Stats: types.DiffStats{Added: 1},
+		},
+	})
+	env.bus.Publish(rec)
+	return rec
+}
+
+func getJSON(t *testing.T, url string, v interface{}) int {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK && v != nil {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatalf("decode %s: %v", url, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestEventsPaging(t *testing.T) {
+	env, srv := newTestServer(t)
+	addEvent(env, "a.go")
+	addEvent(env, "b.go")
+	addEvent(env, "c.go")
+
+	var page eventsPage
+	if code := getJSON(t, srv.URL+"/events?offset=1&limit=1", &page); code != http.StatusOK {
+		t.Fatalf("status %d", code)
+	}
+	if page.Total != 3 || len(page.Events) != 1 {
+		t.Fatalf("unexpected page: %+v", page)
+	}
+	if page.Events[0].ID != 2 || page.Events[0].Path != "b.go" {
+		t.Errorf("expected event 2 b.go, got %+v", page.Events[0])
+	}
+	if page.Events[0].Stats == nil || page.Events[0].Stats.Added != 1 {
+		t.Errorf("expected stats +1, got %+v", page.Events[0].Stats)
+	}
+
+	if code := getJSON(t, srv.URL+"/events?limit=abc", nil); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for bad limit, got %d", code)
+	}
+}
+
+func TestEventDiff(t *testing.T) {
+	env, srv := newTestServer(t)
+	rec := addEvent(env, "a.go")
+
+	var diff types.DiffResult
+	if code := getJSON(t, srv.URL+"/events/1/diff", &diff); code != http.StatusOK {
+		t.Fatalf("status %d", code)
+	}
+	if len(diff.Hunks) != 1 || diff.Hunks[0].Header != rec.Diff.Hunks[0].Header {
+		t.Errorf("unexpected diff: %+v", diff)
+	}
+
+	if code := getJSON(t, srv.URL+"/events/99/diff", nil); code != http.StatusNotFound {
+		t.Errorf("expected 404 for unknown id, got %d", code)
+	}
+	if code := getJSON(t, srv.URL+"/events/1", nil); code != http.StatusNotFound {
+		t.Errorf("expected 404 without /diff suffix, got %d", code)
+	}
+}
+
+func TestStats(t *testing.T) {
+	env, srv := newTestServer(t)
+	addEvent(env, "a.go")
+	addEvent(env, "a.go")
+
+	var stats statsResponse
+	if code := getJSON(t, srv.URL+"/stats", &stats); code != http.StatusOK {
+		t.Fatalf("status %d", code)
+	}
+	if stats.Files != 1 || stats.Added != 2 || stats.GitBranch != "main" {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestChangeSets(t *testing.T) {
+	env, srv := newTestServer(t)
+	addEvent(env, "a.go")
+	addEvent(env, "b.go")
+
+	var sets []store.ChangeSet
+	if code := getJSON(t, srv.URL+"/changesets", &sets); code != http.StatusOK {
+		t.Fatalf("status %d", code)
+	}
+	if len(sets) != 1 || len(sets[0].Events) != 2 || len(sets[0].Files) != 2 || sets[0].Added != 2 {
+		t.Errorf("expected both events in one change set, got %+v", sets)
+	}
+
+	var page eventsPage
+	getJSON(t, srv.URL+"/events", &page)
+	if page.Events[1].ChangeSet != sets[0].ID {
+		t.Errorf("expected events to carry their change set, got %+v", page.Events[1])
+	}
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	_, srv := newTestServer(t)
+	resp, err := http.Post(srv.URL+"/stats", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405, got %d", resp.StatusCode)
+	}
+}
+
+func TestStream(t *testing.T) {
+	env, srv := newTestServer(t)
+
+	resp, err := http.Get(srv.URL + "/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+
+	addEvent(env, "streamed.go")
+
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+
+	deadline := time.After(2 * time.Second)
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				t.Fatal("stream closed before event arrived")
+			}
+			if strings.HasPrefix(line, "data: ") {
+				var ev eventSummary
+				if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &ev); err != nil {
+					t.Fatalf("bad data line %q: %v", line, err)
+				}
+				if ev.Path != "streamed.go" {
+					t.Errorf("expected streamed.go, got %s", ev.Path)
+				}
+				return
+			}
+		case <-deadline:
+			t.Fatal("timeout waiting for streamed event")
+		}
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	env, srv := newTestServer(t)
+	sub := env.bus.Subscribe("tui", 1, bus.DropNewest)
+	defer sub.Close()
+	addEvent(env, "a.go")
+	addEvent(env, "b.go")
+
+	var metrics []bus.Metric
+	if code := getJSON(t, srv.URL+"/metrics", &metrics); code != http.StatusOK {
+		t.Fatalf("status %d", code)
+	}
+	if len(metrics) != 1 || metrics[0].Name != "tui" || metrics[0].Dropped != 1 {
+		t.Errorf("unexpected metrics: %+v", metrics)
+	}
+}
+
+func TestPendingDiff(t *testing.T) {
+	env, srv := newTestServer(t)
+	env.store.Add(types.Record{
+		Event:   types.FileEvent{Path: "slow.go", Op: types.OpModify},
+		Pending: true,
+	})
+
+	if code := getJSON(t, srv.URL+"/events/1/diff", nil); code != http.StatusAccepted {
+		t.Errorf("expected 202 while the diff is pending, got %d", code)
+	}
+}
+
+func TestPatchEndpoint(t *testing.T) {
+	env := &testEnv{store: store.New(), bus: bus.New()}
+	var filtered bool
+	srv := httptest.NewServer(New(Config{
+		Store: env.store,
+		Bus:   env.bus,
+		Patch: func(include func(string) bool) (string, error) {
+			filtered = include != nil && include("src/a.go") && !include("b.go")
+			return "diff --git a/src/a.go b/src/a.go\n", nil
+		},
+	}).Handler())
+	defer srv.Close()
+
+	patch, err := NewClient(strings.TrimPrefix(srv.URL, "http://")).Patch("src/")
+	if err != nil {
+		t.Fatalf("Patch: %v", err)
+	}
+	if !strings.HasPrefix(patch, "diff --git") {
+		t.Errorf("unexpected patch %q", patch)
+	}
+	if !filtered {
+		t.Error("expected path filter to be passed through")
+	}
+}
+
+func TestPatchWithoutGit(t *testing.T) {
+	_, srv := newTestServer(t)
+	_, err := NewClient(strings.TrimPrefix(srv.URL, "http://")).Patch("")
+	if err == nil || !strings.Contains(err.Error(), "requires git") {
+		t.Errorf("expected requires-git error, got %v", err)
+	}
+}
+
+type fakePauser struct{ paused bool }
+
+func (p *fakePauser) Paused() bool          { return p.paused }
+func (p *fakePauser) SetPaused(paused bool) { p.paused = paused }
+
+func TestPauseAndResume(t *testing.T) {
+	p := &fakePauser{}
+	srv := httptest.NewServer(New(Config{Store: store.New(), Pause: p}).Handler())
+	defer srv.Close()
+
+	post := func(path string) pauseResponse {
+		t.Helper()
+		resp, err := http.Post(srv.URL+path, "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var got pauseResponse
+		json.NewDecoder(resp.Body).Decode(&got)
+		return got
+	}
+
+	if got := post("/pause"); !got.Paused || !p.paused {
+		t.Errorf("expected capture paused, got %+v", got)
+	}
+	var stats statsResponse
+	getJSON(t, srv.URL+"/stats", &stats)
+	if !stats.Paused {
+		t.Error("expected stats to report the pause")
+	}
+	if got := post("/resume"); got.Paused || p.paused {
+		t.Errorf("expected capture resumed, got %+v", got)
+	}
+	if code := getJSON(t, srv.URL+"/pause", nil); code != http.StatusMethodNotAllowed {
+		t.Errorf("expected GET /pause to be rejected, got %d", code)
+	}
+}
+
+func TestPauseRejectsBrowserRequests(t *testing.T) {
+	p := &fakePauser{}
+	srv := httptest.NewServer(New(Config{Store: store.New(), Pause: p}).Handler())
+	defer srv.Close()
+	_, port, _ := net.SplitHostPort(strings.TrimPrefix(srv.URL, "http://"))
+
+	for _, tc := range []struct {
+		host, origin string
+		code         int
+	}{
+		{"", "http://evil.example", http.StatusForbidden},
+		{"evil.example:" + port, "", http.StatusForbidden}, // DNS rebinding
+		{"127.0.0.1:1", "", http.StatusForbidden},
+		{"localhost:" + port, "", http.StatusOK},
+		{"", srv.URL, http.StatusOK},
+	} {
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+"/pause", nil)
+		if tc.host != "" {
+			req.Host = tc.host
+		}
+		if tc.origin != "" {
+			req.Header.Set("Origin", tc.origin)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tc.code {
+			t.Errorf("host %q origin %q: expected %d, got %d", tc.host, tc.origin, tc.code, resp.StatusCode)
+		}
+		if tc.code != http.StatusOK && p.paused {
+			t.Fatalf("host %q origin %q: expected capture not to be paused", tc.host, tc.origin)
+		}
+	}
+}
+
+func TestListenUnixKeepsOtherFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "api.sock")
+
+	ln, err := Listen("unix:" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Closing a unix listener removes its socket, so leave a stale one behind.
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	ln.Close()
+	ln, err = Listen("unix:" + path)
+	if err != nil {
+		t.Fatalf("expected a stale socket to be replaced, got %v", err)
+	}
+	ln.Close()
+
+	file := filepath.Join(dir, "notes.txt")
+	os.WriteFile(file, []byte("keep me"), 0644)
+	if _, err := Listen("unix:" + file); err == nil {
+		t.Fatal("expected an error listening on a regular file")
+	}
+	if data, err := os.ReadFile(file); err != nil || string(data) != "keep me" {
+		t.Errorf("expected the file to be left alone, got %q, %v", data, err)
+	}
+}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Client talks to a running session's API server.
+type Client struct {
+	baseURL string
+	http    *http.Client
+}
+
+// NewClient returns a client for addr, using the same syntax as Listen.
+func NewClient(addr string) *Client {
+	c := &Client{
+		baseURL: "http://" + addr,
+		http:    &http.Client{Timeout: 30 * time.Second},
+	}
+	if path := strings.TrimPrefix(addr, "unix:"); path != addr {
+		c.baseURL = "http://agent-spy"
+		c.http.Transport = &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", path)
+			},
+		}
+	}
+	return c
+}
+
+// Patch fetches the session patch, limited to paths containing filter if
+// it is not empty.
+func (c *Client) Patch(filter string) (string, error) {
+	u := c.baseURL + "/patch"
+	if filter != "" {
+		u += "?path=" + url.QueryEscape(filter)
+	}
+	return c.getText(u)
+}
+
+func (c *Client) getText(u string) (string, error) {
+	resp, err := c.http.Get(u)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return string(body), nil
+}
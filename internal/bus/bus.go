@@ -0,0 +1,221 @@
+package bus
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/wgawan/agent-spy/internal/types"
+)
+
+// Policy decides what Publish does when a subscriber's buffer is full.
+type Policy int
+
+const (
+	// Block makes the publisher wait until the subscriber has room, applying
+	// backpressure all the way to the watcher. Use it for consumers that must
+	// not miss events, such as the log file.
+	Block Policy = iota
+	// DropNewest discards the incoming record.
+	DropNewest
+	// DropOldest discards the oldest buffered record to make room.
+	DropOldest
+)
+
+func (p Policy) String() string {
+	switch p {
+	case Block:
+		return "block"
+	case DropNewest:
+		return "drop-newest"
+	case DropOldest:
+		return "drop-oldest"
+	default:
+		return "unknown"
+	}
+}
+
+// Bus fans each published record out to every subscriber. Each subscriber
+// has its own buffer and policy, so a slow consumer only affects others when
+// it asks for backpressure.
+type Bus struct {
+	mu       sync.RWMutex
+	subs     []*Subscription
+	closed   bool
+	quit     chan struct{}
+	quitOnce sync.Once
+}
+
+type Subscription struct {
+	name      string
+	policy    Policy
+	ch        chan types.Record
+	done      chan struct{}
+	once      sync.Once
+	bus       *Bus
+	delivered uint64
+	dropped   uint64
+}
+
+// Metric reports counters for one subscriber. Delivered counts records
+// accepted into the buffer; with DropOldest some of those may later be
+// evicted, which is counted in Dropped.
+type Metric struct {
+	Name      string `json:"name"`
+	Policy    string `json:"policy"`
+	Buffered  int    `json:"buffered"`
+	Capacity  int    `json:"capacity"`
+	Delivered uint64 `json:"delivered"`
+	Dropped   uint64 `json:"dropped"`
+}
+
+func New() *Bus {
+	return &Bus{quit: make(chan struct{})}
+}
+
+// Subscribe registers a consumer with a buffer of the given size. On a closed
+// bus the returned subscription's channel is already closed.
+func (b *Bus) Subscribe(name string, buffer int, policy Policy) *Subscription {
+	s := &Subscription{
+		name:   name,
+		policy: policy,
+		ch:     make(chan types.Record, buffer),
+		done:   make(chan struct{}),
+		bus:    b,
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(s.ch)
+		return s
+	}
+	b.subs = append(b.subs, s)
+	return s
+}
+
+// Publish delivers rec to every subscriber according to its policy.
+func (b *Bus) Publish(rec types.Record) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed {
+		return
+	}
+	for _, s := range b.subs {
+		s.send(rec)
+	}
+}
+
+// Close closes every subscriber channel. Consumers ranging over C() drain
+// what is buffered and then stop. Publishers blocked on a full subscriber
+// are released first.
+func (b *Bus) Close() {
+	b.quitOnce.Do(func() { close(b.quit) })
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	b.closed = true
+	for _, s := range b.subs {
+		close(s.ch)
+	}
+	b.subs = nil
+}
+
+// Metrics returns counters for all current subscribers, sorted by name.
+func (b *Bus) Metrics() []Metric {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	metrics := make([]Metric, 0, len(b.subs))
+	for _, s := range b.subs {
+		metrics = append(metrics, s.Metric())
+	}
+	sort.SliceStable(metrics, func(i, j int) bool {
+		return metrics[i].Name < metrics[j].Name
+	})
+	return metrics
+}
+
+// Dropped returns the total number of records dropped across subscribers.
+func (b *Bus) Dropped() uint64 {
+	var total uint64
+	for _, m := range b.Metrics() {
+		total += m.Dropped
+	}
+	return total
+}
+
+// C returns the channel records are delivered on.
+func (s *Subscription) C() <-chan types.Record {
+	return s.ch
+}
+
+// Close unsubscribes. Any publisher blocked on this subscriber is released.
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		close(s.done)
+		b := s.bus
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		for i, sub := range b.subs {
+			if sub == s {
+				b.subs = append(b.subs[:i], b.subs[i+1:]...)
+				close(s.ch)
+				break
+			}
+		}
+	})
+}
+
+func (s *Subscription) Metric() Metric {
+	return Metric{
+		Name:      s.name,
+		Policy:    s.policy.String(),
+		Buffered:  len(s.ch),
+		Capacity:  cap(s.ch),
+		Delivered: atomic.LoadUint64(&s.delivered),
+		Dropped:   atomic.LoadUint64(&s.dropped),
+	}
+}
+
+// send is called with the bus read lock held, so the channel cannot be
+// closed underneath it.
+func (s *Subscription) send(rec types.Record) {
+	select {
+	case <-s.done:
+		return
+	default:
+	}
+
+	switch s.policy {
+	case Block:
+		select {
+		case s.ch <- rec:
+		case <-s.done:
+			return
+		case <-s.bus.quit:
+			return
+		}
+	case DropNewest:
+		select {
+		case s.ch <- rec:
+		default:
+			atomic.AddUint64(&s.dropped, 1)
+			return
+		}
+	case DropOldest:
+		for sent := false; !sent; {
+			select {
+			case s.ch <- rec:
+				sent = true
+			default:
+				select {
+				case <-s.ch:
+					atomic.AddUint64(&s.dropped, 1)
+				default:
+				}
+			}
+		}
+	}
+	atomic.AddUint64(&s.delivered, 1)
+}
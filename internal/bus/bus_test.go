@@ -0,0 +1,160 @@
+package bus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/wgawan/agent-spy/internal/types"
+)
+
+func rec(id int) types.Record {
+	return types.Record{ID: id, Event: types.FileEvent{Path: "a.go"}}
+}
+
+func TestFanOut(t *testing.T) {
+	b := New()
+	s1 := b.Subscribe("one", 4, Block)
+	s2 := b.Subscribe("two", 4, Block)
+
+	b.Publish(rec(1))
+	b.Publish(rec(2))
+
+	for _, s := range []*Subscription{s1, s2} {
+		for want := 1; want <= 2; want++ {
+			if got := (<-s.C()).ID; got != want {
+				t.Errorf("%s: expected record %d, got %d", s.name, want, got)
+			}
+		}
+	}
+}
+
+func TestDropNewest(t *testing.T) {
+	b := New()
+	s := b.Subscribe("slow", 2, DropNewest)
+	for i := 1; i <= 4; i++ {
+		b.Publish(rec(i))
+	}
+
+	if got := (<-s.C()).ID; got != 1 {
+		t.Errorf("expected oldest record 1 to survive, got %d", got)
+	}
+	m := s.Metric()
+	if m.Dropped != 2 || m.Delivered != 2 {
+		t.Errorf("unexpected metric: %+v", m)
+	}
+}
+
+func TestDropOldest(t *testing.T) {
+	b := New()
+	s := b.Subscribe("slow", 2, DropOldest)
+	for i := 1; i <= 4; i++ {
+		b.Publish(rec(i))
+	}
+
+	if got := (<-s.C()).ID; got != 3 {
+		t.Errorf("expected record 3 after evictions, got %d", got)
+	}
+	if got := (<-s.C()).ID; got != 4 {
+		t.Errorf("expected record 4, got %d", got)
+	}
+	if d := b.Dropped(); d != 2 {
+		t.Errorf("expected 2 dropped, got %d", d)
+	}
+}
+
+func TestBlockAppliesBackpressure(t *testing.T) {
+	b := New()
+	s := b.Subscribe("strict", 1, Block)
+	b.Publish(rec(1))
+
+	published := make(chan struct{})
+	go func() {
+		b.Publish(rec(2))
+		close(published)
+	}()
+
+	select {
+	case <-published:
+		t.Fatal("publish should block while the buffer is full")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	<-s.C()
+	select {
+	case <-published:
+	case <-time.After(time.Second):
+		t.Fatal("publish did not resume after the subscriber drained")
+	}
+}
+
+func TestUnsubscribeReleasesBlockedPublisher(t *testing.T) {
+	b := New()
+	s := b.Subscribe("gone", 1, Block)
+	b.Publish(rec(1))
+
+	published := make(chan struct{})
+	go func() {
+		b.Publish(rec(2))
+		close(published)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	s.Close()
+
+	select {
+	case <-published:
+	case <-time.After(time.Second):
+		t.Fatal("publish stayed blocked after unsubscribe")
+	}
+	if len(b.Metrics()) != 0 {
+		t.Error("expected no subscribers after Close")
+	}
+}
+
+func TestCloseDrainsSubscribers(t *testing.T) {
+	b := New()
+	s := b.Subscribe("log", 4, Block)
+	b.Publish(rec(1))
+	b.Close()
+	b.Publish(rec(2)) // ignored after close
+
+	var ids []int
+	for r := range s.C() {
+		ids = append(ids, r.ID)
+	}
+	if len(ids) != 1 || ids[0] != 1 {
+		t.Errorf("expected to drain [1], got %v", ids)
+	}
+	s.Close() // must not panic after the bus closed the channel
+
+	late := b.Subscribe("late", 1, Block)
+	if _, ok := <-late.C(); ok {
+		t.Error("expected subscription on closed bus to be closed")
+	}
+}
+
+func TestCloseReleasesBlockedPublisher(t *testing.T) {
+	b := New()
+	b.Subscribe("stalled", 1, Block)
+	b.Publish(rec(1))
+
+	published := make(chan struct{})
+	go func() {
+		b.Publish(rec(2))
+		close(published)
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	closed := make(chan struct{})
+	go func() {
+		b.Close()
+		close(closed)
+	}()
+
+	for _, ch := range []chan struct{}{published, closed} {
+		select {
+		case <-ch:
+		case <-time.After(time.Second):
+			t.Fatal("Close deadlocked with a blocked publisher")
+		}
+	}
+}
@@ -0,0 +1,319 @@
+// Package config loads agent-spy's settings from a user-wide and a
+// project-level TOML file. Settings in later files override earlier ones,
+// lists are merged, and command-line flags take precedence over both.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// ProjectFile is the project-level file. It is read from the current
+// directory, not the watched path, though the two are usually the same.
+const ProjectFile = ".agent-spy.toml"
+
+// ProjectSettings are the top-level settings a project file may set, besides
+// [keys] and [theme]. The file usually sits in the watched tree, where the
+// agent being watched can write it, so it may only add to what is filtered
+// and can't stop files being watched or choose which files are written.
+// Config.Project lists what it set, for showing at startup.
+var ProjectSettings = map[string]bool{
+	"debounce":       true,
+	"change-set-gap": true,
+	"filter":         true,
+	"log-format":     true,
+	"log-patch":      true,
+}
+
+// Sources other than a file.
+const (
+	SourceDefault = "default"
+	SourceFlag    = "flag"
+)
+
+// UserFile returns the user-wide file, ~/.config/agent-spy/config.toml (or
+// under $XDG_CONFIG_HOME), or "" if there is no home directory.
+func UserFile() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "agent-spy", "config.toml")
+}
+
+// Setting is a value and where it came from: a file path, SourceFlag or
+// SourceDefault. Lists merged from several places name them all.
+type Setting struct {
+	Values []string // a single one unless List
+	List   bool
+	Source string
+}
+
+// File is a configuration file that was looked for.
+type File struct {
+	Path  string
+	Found bool
+}
+
+// Config is the merged content of the files loaded. Top-level settings are
+// named after command-line flags; [keys] binds TUI actions to keys and
+// [theme] sets colors. Names use dashes, though underscores are accepted.
+type Config struct {
+	Files []File
+	Flags map[string]Setting
+	Keys  map[string]Setting
+	Theme map[string]Setting
+	// Project lists the top-level settings read from a project file, as
+	// "name = value", sorted.
+	Project []string
+}
+
+// Load reads paths in order of increasing precedence, skipping any that
+// don't exist. Files named ProjectFile are held to ProjectSettings.
+func Load(paths ...string) (*Config, error) {
+	c := &Config{
+		Flags: make(map[string]Setting),
+		Keys:  make(map[string]Setting),
+		Theme: make(map[string]Setting),
+	}
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			c.Files = append(c.Files, File{Path: path})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		c.Files = append(c.Files, File{Path: path, Found: true})
+		tables, err := parse(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		for name, values := range tables {
+			var dst map[string]Setting
+			switch name {
+			case "":
+				dst = c.Flags
+			case "keys":
+				dst = c.Keys
+			case "theme":
+				dst = c.Theme
+			default:
+				return nil, fmt.Errorf("%s: unknown table [%s]", path, name)
+			}
+			for k, v := range values {
+				k = normalize(k)
+				if name == "" && filepath.Base(path) == ProjectFile {
+					if !ProjectSettings[k] {
+						return nil, fmt.Errorf("%s: %s can't be set in a project file; set it in %s or with a flag", path, k, UserFile())
+					}
+					c.Project = append(c.Project, k+" = "+v.String())
+				}
+				merge(dst, k, v, path)
+			}
+		}
+	}
+	sort.Strings(c.Project)
+	return c, nil
+}
+
+func normalize(name string) string {
+	return strings.ReplaceAll(name, "_", "-")
+}
+
+// merge sets name from v, appending to a list set earlier.
+func merge(dst map[string]Setting, name string, v value, source string) {
+	prev, ok := dst[name]
+	if !v.isList {
+		dst[name] = Setting{Values: []string{v.scalar}, Source: source}
+		return
+	}
+	s := Setting{Values: v.list, List: true, Source: source}
+	if ok && prev.List {
+		s.Values = append(append([]string{}, prev.Values...), v.list...)
+		s.Source = prev.Source + ", " + source
+	}
+	dst[name] = s
+}
+
+// listFlag is implemented by repeatable flags, whose Get returns []string.
+func listFlag(f *flag.Flag) bool {
+	g, ok := f.Value.(flag.Getter)
+	if !ok {
+		return false
+	}
+	_, ok = g.Get().([]string)
+	return ok
+}
+
+// Apply sets the flags in fs from the top-level settings. Call it before
+// fs.Parse, so flags given on the command line override the files.
+func (c *Config) Apply(fs *flag.FlagSet) error {
+	for _, name := range sortedNames(c.Flags) {
+		s := c.Flags[name]
+		f := fs.Lookup(name)
+		if f == nil || name == "version" {
+			return fmt.Errorf("%s: unknown setting %q", s.Source, name)
+		}
+		if s.List && !listFlag(f) {
+			return fmt.Errorf("%s: %s takes a single value, not a list", s.Source, name)
+		}
+		for _, v := range s.Values {
+			if err := fs.Set(name, v); err != nil {
+				return fmt.Errorf("%s: %s: %w", s.Source, name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// NoteFlags records the flags given on the command line, args, which fs
+// has parsed. fs can't tell them apart from those Apply set.
+func (c *Config) NoteFlags(fs *flag.FlagSet, args []string) {
+	given := make(map[string]bool)
+	shadow := flag.NewFlagSet("", flag.ContinueOnError)
+	shadow.SetOutput(io.Discard)
+	fs.VisitAll(func(f *flag.Flag) {
+		b, ok := f.Value.(interface{ IsBoolFlag() bool })
+		shadow.Var(noted{isBool: ok && b.IsBoolFlag()}, f.Name, "")
+	})
+	shadow.Parse(args)
+	shadow.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+
+	fs.VisitAll(func(f *flag.Flag) {
+		if !given[f.Name] {
+			return
+		}
+		s := Setting{Values: []string{f.Value.String()}, Source: SourceFlag}
+		if listFlag(f) {
+			s.Values = f.Value.(flag.Getter).Get().([]string)
+			s.List = true
+			if prev, ok := c.Flags[f.Name]; ok {
+				s.Source = prev.Source + ", " + SourceFlag
+			}
+		}
+		c.Flags[f.Name] = s
+	})
+}
+
+// noted stands in for a flag when finding out which were given.
+type noted struct{ isBool bool }
+
+func (n noted) String() string   { return "" }
+func (n noted) Set(string) error { return nil }
+func (n noted) IsBoolFlag() bool { return n.isBool }
+
+// Strings returns the last value of each setting in m, for [keys] and
+// [theme].
+func Strings(m map[string]Setting) map[string]string {
+	out := make(map[string]string, len(m))
+	for name, s := range m {
+		if len(s.Values) > 0 {
+			out[name] = s.Values[len(s.Values)-1]
+		}
+	}
+	return out
+}
+
+// Show writes the effective configuration as TOML, noting where each value
+// came from. keys and theme hold the defaults of those tables.
+func (c *Config) Show(w io.Writer, fs *flag.FlagSet, keys, theme map[string]string) {
+	fmt.Fprintln(w, "# Files, lowest precedence first:")
+	for _, f := range c.Files {
+		state := "loaded"
+		if !f.Found {
+			state = "not found"
+		}
+		fmt.Fprintf(w, "#   %s (%s)\n", f.Path, state)
+	}
+	fmt.Fprintln(w)
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Name == "version" {
+			return
+		}
+		source := SourceDefault
+		if s, ok := c.Flags[f.Name]; ok {
+			source = s.Source
+		}
+		fmt.Fprintf(tw, "%s = %s\t# %s\n", f.Name, tomlValue(f.Value), source)
+	})
+	tw.Flush()
+
+	for _, table := range []struct {
+		name     string
+		defaults map[string]string
+		set      map[string]Setting
+	}{{"keys", keys, c.Keys}, {"theme", theme, c.Theme}} {
+		fmt.Fprintf(w, "\n[%s]\n", table.name)
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		for _, name := range sortedKeys(table.defaults) {
+			v, source := table.defaults[name], SourceDefault
+			if s, ok := table.set[name]; ok && len(s.Values) > 0 {
+				v, source = s.Values[len(s.Values)-1], s.Source
+			}
+			fmt.Fprintf(tw, "%s = %q\t# %s\n", name, v, source)
+		}
+		tw.Flush()
+	}
+}
+
+// tomlValue formats a flag's value as TOML.
+func tomlValue(v flag.Value) string {
+	g, ok := v.(flag.Getter)
+	if !ok {
+		return strconv.Quote(v.String())
+	}
+	switch x := g.Get().(type) {
+	case bool, int, int64, uint, uint64, float64:
+		return fmt.Sprint(x)
+	case time.Duration:
+		return strconv.Quote(x.String())
+	case []string:
+		quoted := make([]string, len(x))
+		for i, s := range x {
+			quoted[i] = strconv.Quote(s)
+		}
+		return "[" + strings.Join(quoted, ", ") + "]"
+	default:
+		return strconv.Quote(v.String())
+	}
+}
+
+func sortedNames(m map[string]Setting) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
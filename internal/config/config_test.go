@@ -0,0 +1,170 @@
+package config
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type list []string
+
+func (l *list) String() string     { return strings.Join(*l, ",") }
+func (l *list) Set(v string) error { *l = append(*l, v); return nil }
+func (l *list) Get() interface{}   { return []string(*l) }
+
+func TestParse(t *testing.T) {
+	tables, err := parse(`
+# comment
+debounce = 1_000
+name = "a \"quoted\" # not a comment"
+path = 'C:\dir'
+on = true
+ratio = 0.5
+filter = [
+  "*.log", # trailing comment
+  'tmp/',
+]
+
+[keys]
+"pause" = "P"
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	top := tables[""]
+	want := map[string]value{
+		"debounce": {scalar: "1000"},
+		"name":     {scalar: `a "quoted" # not a comment`},
+		"path":     {scalar: `C:\dir`},
+		"on":       {scalar: "true"},
+		"ratio":    {scalar: "0.5"},
+		"filter":   {list: []string{"*.log", "tmp/"}, isList: true},
+	}
+	if !reflect.DeepEqual(top, want) {
+		t.Errorf("got %+v, want %+v", top, want)
+	}
+	if tables["keys"]["pause"].scalar != "P" {
+		t.Errorf("expected [keys] pause, got %+v", tables["keys"])
+	}
+
+	for _, bad := range []string{
+		"debounce = bare",
+		"name = \"unterminated",
+		"filter = [\"a\" \"b\"]",
+		"a = 1\na = 2",
+		"[keys]\n[keys]",
+		"a = 1 b = 2",
+	} {
+		if _, err := parse(bad); err == nil {
+			t.Errorf("expected an error for %q", bad)
+		}
+	}
+}
+
+func TestLayering(t *testing.T) {
+	dir := t.TempDir()
+	user := filepath.Join(dir, "config.toml")
+	project := filepath.Join(dir, ".agent-spy.toml")
+	os.WriteFile(user, []byte("debounce = 300\nlog_format = \"jsonl\"\nfilter = [\"*.log\"]\n[theme]\naccent = \"99\"\n"), 0644)
+	os.WriteFile(project, []byte("debounce = 200\nfilter = [\"tmp/\"]\n"), 0644)
+
+	c, err := Load(user, project, filepath.Join(dir, "missing.toml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Files) != 3 || !c.Files[0].Found || c.Files[2].Found {
+		t.Errorf("unexpected files %+v", c.Files)
+	}
+	if want := []string{"debounce = 200", "filter = [tmp/]"}; !reflect.DeepEqual(c.Project, want) {
+		t.Errorf("expected project settings %v, got %v", want, c.Project)
+	}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	debounce := fs.Int("debounce", 500, "")
+	format := fs.String("log-format", "text", "")
+	gap := fs.Duration("gap", time.Second, "")
+	var filters list
+	fs.Var(&filters, "filter", "")
+
+	if err := c.Apply(fs); err != nil {
+		t.Fatal(err)
+	}
+	args := []string{"-debounce", "100", "-filter", "*.bak"}
+	fs.Parse(args)
+	c.NoteFlags(fs, args)
+
+	if *debounce != 100 || *format != "jsonl" || *gap != time.Second {
+		t.Errorf("unexpected values debounce=%d format=%s gap=%s", *debounce, *format, *gap)
+	}
+	if want := []string{"*.log", "tmp/", "*.bak"}; !reflect.DeepEqual([]string(filters), want) {
+		t.Errorf("expected lists to merge in order, got %v", filters)
+	}
+	if s := c.Flags["log-format"]; s.Source != user {
+		t.Errorf("expected log-format from the user file, got %q", s.Source)
+	}
+	if s := c.Flags["debounce"]; s.Source != SourceFlag {
+		t.Errorf("expected debounce from the flag, got %q", s.Source)
+	}
+
+	var out bytes.Buffer
+	c.Show(&out, fs, map[string]string{"pause": "p"}, map[string]string{"accent": "62"})
+	for _, want := range []string{
+		"debounce = 100",
+		`filter = ["*.log", "tmp/", "*.bak"]  # ` + user + ", " + project + ", flag",
+		`gap = "1s"`,
+		`pause = "p"  # default`,
+		`accent = "99"  # ` + user,
+		"missing.toml (not found)",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("show output missing %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestProjectFileSettings(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, ProjectFile)
+	for content, ok := range map[string]bool{
+		"debounce = 200\nchange_set_gap = \"5s\"":         true,
+		"[keys]\npause = \"P\"\n[theme]\naccent = \"99\"": true,
+		"filter = [\"vendor/\"]\nlog_format = \"jsonl\"":  true,
+		"include = [\"*.md\"]":                            false,
+		"unfilter = [\"vendor/\"]":                        false,
+		"no-git = true":                                   false,
+		"log = \"session.log\"":                           false,
+		"summary-md = \"README.md\"":                      false,
+	} {
+		os.WriteFile(path, []byte(content), 0644)
+		_, err := Load(path)
+		if ok && err != nil {
+			t.Errorf("expected %q to be allowed, got %v", content, err)
+		}
+		if !ok && (err == nil || !strings.Contains(err.Error(), path)) {
+			t.Errorf("expected an error naming the file for %q, got %v", content, err)
+		}
+	}
+}
+
+func TestApplyRejectsUnknownSettings(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.toml")
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Int("debounce", 500, "")
+
+	for _, content := range []string{"debounse = 1", "debounce = [1, 2]", "debounce = \"soon\"", "[colors]\n"} {
+		os.WriteFile(path, []byte(content), 0644)
+		c, err := Load(path)
+		if err == nil {
+			err = c.Apply(fs)
+		}
+		if err == nil || !strings.Contains(err.Error(), path) {
+			t.Errorf("expected an error naming the file for %q, got %v", content, err)
+		}
+	}
+}
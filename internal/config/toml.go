@@ -0,0 +1,247 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// value is a setting as written in a file: a scalar, or a list of them.
+// Scalars are kept as the text a flag would be given.
+type value struct {
+	scalar string
+	list   []string
+	isList bool
+}
+
+// String formats v for messages: the scalar, or the list in brackets.
+func (v value) String() string {
+	if !v.isList {
+		return v.scalar
+	}
+	return "[" + strings.Join(v.list, ", ") + "]"
+}
+
+// parse reads the subset of TOML agent-spy's files use: tables, bare or
+// quoted keys, and values that are strings, numbers, booleans or arrays of
+// them. Keys before the first table belong to table "".
+func parse(src string) (map[string]map[string]value, error) {
+	tables := map[string]map[string]value{"": {}}
+	table := ""
+	p := &parser{src: src, line: 1}
+	for {
+		p.skipSpace(true)
+		if p.eof() {
+			return tables, nil
+		}
+		if p.peek() == '[' {
+			p.pos++
+			name, err := p.key()
+			if err != nil {
+				return nil, err
+			}
+			p.skipSpace(false)
+			if !p.consume(']') {
+				return nil, p.errorf("expected ] after table name")
+			}
+			if _, dup := tables[name]; dup && name != "" {
+				return nil, p.errorf("table [%s] defined twice", name)
+			}
+			table = name
+			tables[table] = map[string]value{}
+		} else {
+			k, err := p.key()
+			if err != nil {
+				return nil, err
+			}
+			p.skipSpace(false)
+			if !p.consume('=') {
+				return nil, p.errorf("expected = after %s", k)
+			}
+			p.skipSpace(false)
+			v, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			if _, dup := tables[table][k]; dup {
+				return nil, p.errorf("%s set twice", k)
+			}
+			tables[table][k] = v
+		}
+		if !p.endOfLine() {
+			return nil, p.errorf("unexpected %q", p.peek())
+		}
+	}
+}
+
+type parser struct {
+	src  string
+	pos  int
+	line int
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("line %d: %s", p.line, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) eof() bool  { return p.pos >= len(p.src) }
+func (p *parser) peek() byte { return p.src[p.pos] }
+
+func (p *parser) consume(c byte) bool {
+	if !p.eof() && p.peek() == c {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// skipSpace skips blanks and comments, and newlines too if newlines is set.
+func (p *parser) skipSpace(newlines bool) {
+	for !p.eof() {
+		switch c := p.peek(); {
+		case c == ' ' || c == '\t' || c == '\r':
+			p.pos++
+		case c == '\n' && newlines:
+			p.pos++
+			p.line++
+		case c == '#':
+			for !p.eof() && p.peek() != '\n' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// endOfLine skips to the next line, reporting false if anything but a
+// comment is in the way.
+func (p *parser) endOfLine() bool {
+	p.skipSpace(false)
+	if p.eof() {
+		return true
+	}
+	if p.peek() != '\n' {
+		return false
+	}
+	p.pos++
+	p.line++
+	return true
+}
+
+func (p *parser) key() (string, error) {
+	p.skipSpace(false)
+	if p.eof() {
+		return "", p.errorf("expected a key")
+	}
+	if c := p.peek(); c == '"' || c == '\'' {
+		return p.str()
+	}
+	start := p.pos
+	for !p.eof() {
+		c := p.peek()
+		if !(c == '_' || c == '-' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			break
+		}
+		p.pos++
+	}
+	if p.pos == start {
+		return "", p.errorf("expected a key, got %q", p.peek())
+	}
+	return p.src[start:p.pos], nil
+}
+
+func (p *parser) value() (value, error) {
+	if p.eof() {
+		return value{}, p.errorf("expected a value")
+	}
+	if p.peek() != '[' {
+		s, err := p.scalar()
+		return value{scalar: s}, err
+	}
+	p.pos++
+	v := value{isList: true, list: []string{}}
+	for {
+		p.skipSpace(true)
+		if p.consume(']') {
+			return v, nil
+		}
+		if p.eof() {
+			return value{}, p.errorf("unterminated array")
+		}
+		s, err := p.scalar()
+		if err != nil {
+			return value{}, err
+		}
+		v.list = append(v.list, s)
+		p.skipSpace(true)
+		if !p.consume(',') {
+			p.skipSpace(true)
+			if !p.consume(']') {
+				return value{}, p.errorf("expected , or ] in array")
+			}
+			return v, nil
+		}
+	}
+}
+
+func (p *parser) scalar() (string, error) {
+	if c := p.peek(); c == '"' || c == '\'' {
+		return p.str()
+	}
+	start := p.pos
+	for !p.eof() && !strings.ContainsRune(" \t\r\n#,]", rune(p.peek())) {
+		p.pos++
+	}
+	word := p.src[start:p.pos]
+	switch {
+	case word == "true" || word == "false":
+		return word, nil
+	case word == "":
+		return "", p.errorf("expected a value, got %q", p.peek())
+	}
+	num := strings.ReplaceAll(word, "_", "")
+	if _, err := strconv.ParseInt(num, 0, 64); err == nil {
+		return num, nil
+	}
+	if _, err := strconv.ParseFloat(num, 64); err == nil {
+		return num, nil
+	}
+	return "", p.errorf("invalid value %q (strings must be quoted)", word)
+}
+
+// str reads a basic "..." string, with escapes, or a literal '...' one.
+func (p *parser) str() (string, error) {
+	quote := p.peek()
+	p.pos++
+	var b strings.Builder
+	for {
+		if p.eof() || p.peek() == '\n' {
+			return "", p.errorf("unterminated string")
+		}
+		c := p.peek()
+		p.pos++
+		switch {
+		case c == quote:
+			return b.String(), nil
+		case c == '\\' && quote == '"':
+			if p.eof() {
+				return "", p.errorf("unterminated string")
+			}
+			esc := p.peek()
+			p.pos++
+			switch esc {
+			case '"', '\\':
+				b.WriteByte(esc)
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			default:
+				return "", p.errorf("unsupported escape \\%c", esc)
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+}
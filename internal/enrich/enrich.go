@@ -0,0 +1,224 @@
+package enrich
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash/fnv"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wgawan/agent-spy/internal/bus"
+	"github.com/wgawan/agent-spy/internal/git"
+	"github.com/wgawan/agent-spy/internal/store"
+	"github.com/wgawan/agent-spy/internal/types"
+)
+
+// DefaultWorkers is the size of the diff worker pool.
+const DefaultWorkers = 4
+
+// GitCauseWindow is how close to a git operation a file change must happen
+// to be attributed to it.
+const GitCauseWindow = 2 * time.Second
+
+// Differ computes a file's content change since it was last seen.
+// *git.Repo implements it.
+type Differ interface {
+	Change(relPath string) (git.Change, error)
+}
+
+// RootDiffer routes events from several watched roots to each root's
+// differ. Paths start with the root label, which is stripped before the
+// path is passed on.
+type RootDiffer map[string]Differ
+
+func (rd RootDiffer) Change(path string) (git.Change, error) {
+	root, rel, _ := strings.Cut(filepath.ToSlash(path), "/")
+	d, ok := rd[root]
+	if !ok {
+		return git.Change{}, fmt.Errorf("no watched root for %s", path)
+	}
+	return d.Change(filepath.FromSlash(rel))
+}
+
+// Enricher turns raw watcher events into records. Computing a change
+// advances the differ's snapshot, so it must happen exactly once per event;
+// the enricher is the only caller and every consumer reads its output.
+//
+// Each event is published immediately as a pending record and its diff is
+// computed by a pool of workers. Events are sharded across workers by path,
+// so changes to the same file are always diffed in the order they happened.
+type Enricher struct {
+	differ  Differ
+	store   *store.Store
+	bus     *bus.Bus
+	workers int
+	catchUp bool
+
+	lastGit map[string]gitCause // most recent git operation per root
+}
+
+type gitCause struct {
+	op *types.GitOp
+	at time.Time
+}
+
+// New creates an enricher that records into st and publishes on b. A nil
+// differ produces records without diffs or hashes.
+func New(d Differ, st *store.Store, b *bus.Bus) *Enricher {
+	return &Enricher{
+		differ:  d,
+		store:   st,
+		bus:     b,
+		workers: DefaultWorkers,
+		lastGit: make(map[string]gitCause),
+	}
+}
+
+// SetCatchUp makes changes made while the watcher was paused show up as one
+// catch-up event per file. By default they only bring the differ's snapshot
+// up to date, so a file's next diff starts from its content at resume. It
+// must be called before Run.
+func (e *Enricher) SetCatchUp(on bool) {
+	e.catchUp = on
+}
+
+// resync reports whether ev only brings the snapshot up to date.
+func (e *Enricher) resync(ev types.FileEvent) bool {
+	return ev.Paused && !e.catchUp
+}
+
+// Run enriches events until the channel is closed, then waits for pending
+// diffs to finish.
+func (e *Enricher) Run(events <-chan types.FileEvent) {
+	if e.differ == nil {
+		for ev := range events {
+			if !e.resync(ev) {
+				e.bus.Publish(e.store.Add(e.record(ev)))
+			}
+		}
+		return
+	}
+
+	var wg sync.WaitGroup
+	queues := make([]chan types.Record, e.workers)
+	for i := range queues {
+		queues[i] = make(chan types.Record, 64)
+		wg.Add(1)
+		go func(q <-chan types.Record) {
+			defer wg.Done()
+			for rec := range q {
+				if e.resync(rec.Event) {
+					e.differ.Change(rec.Event.Path)
+					continue
+				}
+				e.complete(rec)
+			}
+		}(queues[i])
+	}
+
+	for ev := range events {
+		if e.resync(ev) {
+			if ev.IsFile() {
+				// Queued behind the file's earlier changes
+				queues[shard(ev.Path, len(queues))] <- types.Record{Event: ev}
+			}
+			continue
+		}
+		rec := e.record(ev)
+		if !ev.IsFile() {
+			// Nothing to diff
+			e.bus.Publish(e.store.Add(rec))
+			continue
+		}
+		rec.Pending = true
+		rec = e.store.Add(rec)
+		e.bus.Publish(rec)
+		queues[shard(ev.Path, len(queues))] <- rec
+	}
+
+	for _, q := range queues {
+		close(q)
+	}
+	wg.Wait()
+}
+
+// Enrich builds the complete record for ev synchronously, stores it and
+// publishes it. An event that only brings the snapshot up to date is
+// neither stored nor published.
+func (e *Enricher) Enrich(ev types.FileEvent) types.Record {
+	if e.resync(ev) {
+		if e.differ != nil && ev.IsFile() {
+			e.differ.Change(ev.Path)
+		}
+		return types.Record{Event: ev}
+	}
+	rec := e.record(ev)
+	if !ev.IsFile() {
+		rec = e.store.Add(rec)
+		e.bus.Publish(rec)
+		return rec
+	}
+	rec.Pending = true
+	return e.complete(e.store.Add(rec))
+}
+
+// record starts the record for ev. File changes made around the time of a
+// git operation in the same root (a checkout rewriting files, say) are
+// attributed to it.
+func (e *Enricher) record(ev types.FileEvent) types.Record {
+	rec := types.Record{Event: ev}
+	if ev.Op == types.OpGit {
+		e.lastGit[ev.Root] = gitCause{op: ev.Git, at: ev.Timestamp}
+		return rec
+	}
+	if last, ok := e.lastGit[ev.Root]; ok && last.op != nil {
+		d := ev.Timestamp.Sub(last.at)
+		if d > -GitCauseWindow && d < GitCauseWindow {
+			rec.CausedBy = last.op.Summary
+		}
+	}
+	return rec
+}
+
+// complete computes the diff for a pending record and publishes the result.
+func (e *Enricher) complete(rec types.Record) types.Record {
+	rec.Pending = false
+	if e.differ != nil && rec.Event.IsFile() {
+		c, _ := e.differ.Change(rec.Event.Path)
+		rec.Diff = c.Diff
+		if c.BeforeExists {
+			rec.BeforeHash = sum(c.Before, c.BeforeSum)
+		}
+		if c.AfterExists {
+			rec.AfterHash = sum(c.After, c.AfterSum)
+		}
+		rec.NoOp = (rec.Event.Op == types.OpModify || rec.Event.Op == types.OpCreate) &&
+			c.BeforeExists && c.AfterExists && rec.BeforeHash == rec.AfterHash
+	}
+	e.store.Update(rec)
+	e.bus.Publish(rec)
+	return rec
+}
+
+func shard(path string, n int) int {
+	h := fnv.New32a()
+	h.Write([]byte(path))
+	return int(h.Sum32() % uint32(n))
+}
+
+// sum returns the hash of content, or known if the differ already hashed
+// it, as it does for files too large to hold.
+func sum(content, known string) string {
+	if known != "" {
+		return known
+	}
+	return hashContent(content)
+}
+
+func hashContent(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
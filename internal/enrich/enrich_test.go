@@ -0,0 +1,258 @@
+package enrich
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/wgawan/agent-spy/internal/bus"
+	"github.com/wgawan/agent-spy/internal/git"
+	"github.com/wgawan/agent-spy/internal/store"
+	"github.com/wgawan/agent-spy/internal/types"
+)
+
+func TestEnrichComputesDiffOnce(t *testing.T) {
+	dir := t.TempDir()
+	repo, _ := git.Open(dir)
+	st := store.New()
+	b := bus.New()
+	tuiSub := b.Subscribe("tui", 4, bus.Block)
+	logSub := b.Subscribe("log", 4, bus.Block)
+
+	e := New(repo, st, b)
+	os.WriteFile(filepath.Join(dir, "app.go"), []byte("package main\n"), 0644)
+	rec := e.Enrich(types.FileEvent{Path: "app.go", Op: types.OpCreate, Timestamp: time.Now()})
+
+	if rec.ID != 1 {
+		t.Errorf("expected ID 1, got %d", rec.ID)
+	}
+	if !rec.Diff.Available || rec.Diff.Stats.Added != 1 {
+		t.Errorf("expected a one-line addition, got %+v", rec.Diff)
+	}
+	if rec.BeforeHash != "" {
+		t.Errorf("expected no before hash for a new file, got %s", rec.BeforeHash)
+	}
+	if rec.AfterHash != hashContent("package main\n") {
+		t.Errorf("unexpected after hash %s", rec.AfterHash)
+	}
+
+	// Every consumer sees the same diff, not a second "no changes" result.
+	for _, sub := range []*bus.Subscription{tuiSub, logSub} {
+		got := <-sub.C()
+		if got.ID != rec.ID || got.Diff.Stats != rec.Diff.Stats {
+			t.Errorf("subscriber saw %+v, want %+v", got, rec)
+		}
+	}
+	if stored, ok := st.Get(rec.ID); !ok || stored.AfterHash != rec.AfterHash {
+		t.Errorf("store has %+v, want %+v", stored, rec)
+	}
+}
+
+func TestEnrichChainsHashes(t *testing.T) {
+	dir := t.TempDir()
+	repo, _ := git.Open(dir)
+	e := New(repo, store.New(), bus.New())
+	f := filepath.Join(dir, "notes.txt")
+
+	os.WriteFile(f, []byte("one\n"), 0644)
+	first := e.Enrich(types.FileEvent{Path: "notes.txt", Op: types.OpCreate})
+	os.WriteFile(f, []byte("two\n"), 0644)
+	second := e.Enrich(types.FileEvent{Path: "notes.txt", Op: types.OpModify})
+	os.Remove(f)
+	third := e.Enrich(types.FileEvent{Path: "notes.txt", Op: types.OpDelete})
+
+	if second.BeforeHash != first.AfterHash {
+		t.Error("expected second event to start where the first ended")
+	}
+	if third.BeforeHash != second.AfterHash || third.AfterHash != "" {
+		t.Errorf("unexpected delete hashes: before=%s after=%s", third.BeforeHash, third.AfterHash)
+	}
+}
+
+func TestEnrichWithoutDiffer(t *testing.T) {
+	e := New(nil, store.New(), bus.New())
+	rec := e.Enrich(types.FileEvent{Path: "a.go", Op: types.OpModify})
+	if rec.Diff.Available || rec.AfterHash != "" {
+		t.Errorf("expected bare record without a differ, got %+v", rec)
+	}
+}
+
+func TestRunPublishesPendingThenReady(t *testing.T) {
+	dir := t.TempDir()
+	repo, _ := git.Open(dir)
+	st := store.New()
+	b := bus.New()
+	sub := b.Subscribe("tui", 16, bus.Block)
+
+	os.WriteFile(filepath.Join(dir, "app.go"), []byte("package main\n"), 0644)
+	events := make(chan types.FileEvent, 1)
+	events <- types.FileEvent{Path: "app.go", Op: types.OpCreate}
+	close(events)
+	New(repo, st, b).Run(events)
+
+	pending := <-sub.C()
+	if !pending.Pending || pending.Diff.Available {
+		t.Errorf("expected pending record first, got %+v", pending)
+	}
+	ready := <-sub.C()
+	if ready.Pending || ready.ID != pending.ID || !ready.Diff.Available {
+		t.Errorf("expected ready record for ID %d, got %+v", pending.ID, ready)
+	}
+	if stored, _ := st.Get(ready.ID); stored.Pending {
+		t.Error("expected store to hold the ready record")
+	}
+}
+
+type nopDiffer struct{}
+
+func (nopDiffer) Change(relPath string) (git.Change, error) {
+	return git.Change{}, nil
+}
+
+func TestRunKeepsPerFileOrder(t *testing.T) {
+	st := store.New()
+	b := bus.New()
+	sub := b.Subscribe("tui", 1024, bus.Block)
+
+	events := make(chan types.FileEvent, 100)
+	paths := []string{"a.go", "b.go", "c.go", "d.go", "e.go"}
+	for i := 0; i < 100; i++ {
+		events <- types.FileEvent{Path: paths[i%len(paths)], Op: types.OpModify}
+	}
+	close(events)
+	New(nopDiffer{}, st, b).Run(events)
+
+	lastReady := map[string]int{}
+	for i := 0; i < 200; i++ {
+		rec := <-sub.C()
+		if rec.Pending {
+			continue
+		}
+		if rec.ID < lastReady[rec.Event.Path] {
+			t.Fatalf("%s: record %d completed after %d", rec.Event.Path, rec.ID, lastReady[rec.Event.Path])
+		}
+		lastReady[rec.Event.Path] = rec.ID
+	}
+}
+
+func TestEnrichAttributesChangesToGitOps(t *testing.T) {
+	b := bus.New()
+	sub := b.Subscribe("tui", 8, bus.Block)
+	e := New(nopDiffer{}, store.New(), b)
+	now := time.Now()
+
+	op := &types.GitOp{Kind: "checkout", Summary: "checkout main → feature"}
+	git := e.Enrich(types.FileEvent{Path: ".git", Op: types.OpGit, Timestamp: now, Git: op})
+	if git.Pending || git.Event.Git != op {
+		t.Errorf("expected git op published complete, got %+v", git)
+	}
+	if got := <-sub.C(); got.ID != git.ID || got.Pending {
+		t.Errorf("expected a single ready record for the git op, got %+v", got)
+	}
+
+	during := e.Enrich(types.FileEvent{Path: "a.go", Op: types.OpModify, Timestamp: now.Add(300 * time.Millisecond)})
+	later := e.Enrich(types.FileEvent{Path: "a.go", Op: types.OpModify, Timestamp: now.Add(time.Minute)})
+	if during.CausedBy != op.Summary {
+		t.Errorf("expected change during checkout to be attributed, got %q", during.CausedBy)
+	}
+	if later.CausedBy != "" {
+		t.Errorf("expected later change to be unattributed, got %q", later.CausedBy)
+	}
+}
+
+type pathDiffer []string
+
+func (d *pathDiffer) Change(relPath string) (git.Change, error) {
+	*d = append(*d, relPath)
+	return git.Change{}, nil
+}
+
+func TestRootDifferRoutesByLabel(t *testing.T) {
+	var svc, lib pathDiffer
+	rd := RootDiffer{"svc": &svc, "lib": &lib}
+
+	rd.Change(filepath.Join("svc", "cmd", "main.go"))
+	rd.Change(filepath.Join("lib", "util.go"))
+	if len(svc) != 1 || svc[0] != filepath.Join("cmd", "main.go") {
+		t.Errorf("svc got %v", svc)
+	}
+	if len(lib) != 1 || lib[0] != "util.go" {
+		t.Errorf("lib got %v", lib)
+	}
+	if _, err := rd.Change("other/x.go"); err == nil {
+		t.Error("expected an error for an unknown root")
+	}
+}
+
+func TestGitOpsOnlyExplainTheirRoot(t *testing.T) {
+	e := New(nopDiffer{}, store.New(), bus.New())
+	now := time.Now()
+
+	op := &types.GitOp{Kind: "checkout", Summary: "checkout main → feature"}
+	e.Enrich(types.FileEvent{Root: "svc", Path: "svc/.git", Op: types.OpGit, Timestamp: now, Git: op})
+
+	same := e.Enrich(types.FileEvent{Root: "svc", Path: "svc/a.go", Op: types.OpModify, Timestamp: now})
+	other := e.Enrich(types.FileEvent{Root: "lib", Path: "lib/a.go", Op: types.OpModify, Timestamp: now})
+	if same.CausedBy != op.Summary {
+		t.Errorf("expected change in svc to be attributed, got %q", same.CausedBy)
+	}
+	if other.CausedBy != "" {
+		t.Errorf("expected change in lib to be unattributed, got %q", other.CausedBy)
+	}
+}
+
+type fixedDiffer git.Change
+
+func (d fixedDiffer) Change(relPath string) (git.Change, error) {
+	return git.Change(d), nil
+}
+
+func TestEnrichMarksNoOpWrites(t *testing.T) {
+	same := fixedDiffer{Before: "x\n", After: "x\n", BeforeExists: true, AfterExists: true}
+	rec := New(same, store.New(), bus.New()).Enrich(types.FileEvent{Path: "a.go", Op: types.OpModify})
+	if !rec.NoOp {
+		t.Error("expected an identical rewrite to be marked no-op")
+	}
+
+	changed := fixedDiffer{Before: "x\n", After: "y\n", BeforeExists: true, AfterExists: true}
+	rec = New(changed, store.New(), bus.New()).Enrich(types.FileEvent{Path: "a.go", Op: types.OpModify})
+	if rec.NoOp {
+		t.Error("expected a real change not to be marked no-op")
+	}
+
+	created := fixedDiffer{After: "", AfterExists: true}
+	rec = New(created, store.New(), bus.New()).Enrich(types.FileEvent{Path: "a.go", Op: types.OpCreate})
+	if rec.NoOp {
+		t.Error("expected creating an empty file not to be marked no-op")
+	}
+}
+
+func TestEnrichResyncsPausedChanges(t *testing.T) {
+	dir := t.TempDir()
+	repo, _ := git.Open(dir)
+	st := store.New()
+	e := New(repo, st, bus.New())
+	f := filepath.Join(dir, "notes.txt")
+
+	os.WriteFile(f, []byte("one\n"), 0644)
+	e.Enrich(types.FileEvent{Path: "notes.txt", Op: types.OpCreate})
+	os.WriteFile(f, []byte("one\nmine\n"), 0644)
+	e.Enrich(types.FileEvent{Path: "notes.txt", Op: types.OpModify, Paused: true})
+	if st.Len() != 1 {
+		t.Fatalf("expected the paused change not to be recorded, got %d records", st.Len())
+	}
+
+	os.WriteFile(f, []byte("one\nmine\nagent\n"), 0644)
+	rec := e.Enrich(types.FileEvent{Path: "notes.txt", Op: types.OpModify})
+	if rec.Diff.Stats.Added != 1 || rec.Diff.Stats.Deleted != 0 {
+		t.Errorf("expected only the agent's line, got %+v", rec.Diff.Stats)
+	}
+
+	e.SetCatchUp(true)
+	os.WriteFile(f, []byte("two\n"), 0644)
+	rec = e.Enrich(types.FileEvent{Path: "notes.txt", Op: types.OpModify, Paused: true})
+	if rec.ID == 0 || !rec.Event.Paused || !rec.Diff.Available {
+		t.Errorf("expected a catch-up record with a diff, got %+v", rec)
+	}
+}
@@ -0,0 +1,139 @@
+package git
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DefaultBaselineMaxSize is the largest file, in bytes, recorded in the
+// baseline by default.
+const DefaultBaselineMaxSize = 1 << 20
+
+// baseline is the content of the watched files at startup, for diffing the
+// first change to a file that isn't in HEAD. Content is kept compressed,
+// once per distinct file.
+type baseline struct {
+	files map[string]string // file path -> content hash
+	blobs map[string][]byte // content hash -> compressed content
+	done  int
+	total int
+}
+
+// LoadBaseline records the current content of files, given relative to the
+// watched path, skipping any over maxSize bytes. Until a file changes, its
+// first diff is then against this content rather than HEAD, so pre-existing
+// untracked files, or any file outside git, don't show as all additions.
+// It is meant to run in the background while events are diffed, with since
+// the time watching started. Files already diffed by the time they are
+// reached, modified after since or while being read are skipped: their
+// content is no longer what they started with.
+func (r *Repo) LoadBaseline(files []string, maxSize int64, since time.Time) {
+	r.mu.Lock()
+	r.baseline = &baseline{
+		files: make(map[string]string),
+		blobs: make(map[string][]byte),
+		total: len(files),
+	}
+	r.mu.Unlock()
+
+	for _, rel := range files {
+		content, ok := readBaseline(filepath.Join(r.path, rel), maxSize, since)
+		var sum string
+		var blob []byte
+		if ok {
+			h := sha256.Sum256(content)
+			sum = hex.EncodeToString(h[:])
+			r.mu.Lock()
+			_, stored := r.baseline.blobs[sum]
+			r.mu.Unlock()
+			if !stored {
+				blob = compress(content)
+			}
+		}
+
+		r.mu.Lock()
+		_, seen := r.snapshots[rel]
+		if ok && !seen {
+			r.baseline.files[rel] = sum
+			if blob != nil {
+				r.baseline.blobs[sum] = blob
+			}
+		}
+		r.baseline.done++
+		r.mu.Unlock()
+	}
+}
+
+// BaselineProgress reports how many files LoadBaseline has read out of how
+// many it was given; both are 0 if it hasn't been called.
+func (r *Repo) BaselineProgress() (done, total int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.baseline == nil {
+		return 0, 0
+	}
+	return r.baseline.done, r.baseline.total
+}
+
+// baselineBase returns relPath's content at startup, or false if it wasn't
+// recorded. Each file's baseline is used once, as its first snapshot.
+func (r *Repo) baselineBase(relPath string) (base, bool) {
+	r.mu.Lock()
+	var blob []byte
+	if r.baseline != nil {
+		if sum, ok := r.baseline.files[relPath]; ok {
+			blob = r.baseline.blobs[sum]
+			delete(r.baseline.files, relPath)
+		}
+	}
+	r.mu.Unlock()
+	if blob == nil {
+		return base{}, false
+	}
+	content, err := io.ReadAll(flate.NewReader(bytes.NewReader(blob)))
+	if err != nil {
+		return base{}, false
+	}
+	return stored(string(content)), true
+}
+
+func readBaseline(path string, maxSize int64, since time.Time) ([]byte, bool) {
+	info, err := os.Lstat(path)
+	if err != nil || !info.Mode().IsRegular() || info.Size() > maxSize || info.ModTime().After(since) {
+		return nil, false
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	after, err := os.Lstat(path)
+	if err != nil || !os.SameFile(info, after) || !after.ModTime().Equal(info.ModTime()) || after.Size() != info.Size() {
+		return nil, false
+	}
+	return content, true
+}
+
+func compress(content []byte) []byte {
+	var buf bytes.Buffer
+	fw, _ := flate.NewWriter(&buf, flate.BestSpeed)
+	fw.Write(content)
+	fw.Close()
+	return buf.Bytes()
+}
+
+// stored makes a snapshot of content kept outside the worktree, summarizing
+// it without keeping it if it's over MaxDiffSize.
+func stored(content string) base {
+	if int64(len(content)) > MaxDiffSize {
+		bin, _ := summarize(strings.NewReader(content), int64(len(content)))
+		return base{exists: true, bin: bin, partial: true}
+	}
+	return loaded(content)
+}
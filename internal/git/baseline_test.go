@@ -0,0 +1,76 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBaselineOutsideGit(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("one\ntwo\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "copy.txt"), []byte("one\ntwo\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "big.txt"), []byte(strings.Repeat("x\n", 100)), 0644)
+	r, _ := Open(dir)
+
+	r.LoadBaseline([]string{"big.txt", "copy.txt", "notes.txt"}, 64, time.Now())
+	if done, total := r.BaselineProgress(); done != 3 || total != 3 {
+		t.Errorf("expected 3/3 files read, got %d/%d", done, total)
+	}
+	if n := len(r.baseline.blobs); n != 1 {
+		t.Errorf("expected identical files to share content, got %d blobs", n)
+	}
+
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("one\ntwo\nthree\n"), 0644)
+	c, _ := r.Change("notes.txt")
+	if !c.BeforeExists || c.Before != "one\ntwo\n" {
+		t.Errorf("expected the startup content as before, got %q", c.Before)
+	}
+	if c.Diff.Stats.Added != 1 || c.Diff.Stats.Deleted != 0 {
+		t.Errorf("expected a one-line addition, got %+v", c.Diff.Stats)
+	}
+
+	// Over the size cap, so diffed as before: all additions
+	os.WriteFile(filepath.Join(dir, "big.txt"), []byte(strings.Repeat("x\n", 101)), 0644)
+	if c, _ := r.Change("big.txt"); c.BeforeExists || c.Diff.Stats.Added != 101 {
+		t.Errorf("expected big.txt to be left out of the baseline, got %+v", c.Diff.Stats)
+	}
+}
+
+func TestBaselineSkipsChangedFiles(t *testing.T) {
+	dir := t.TempDir()
+	f := filepath.Join(dir, "a.txt")
+	os.WriteFile(f, []byte("a\n"), 0644)
+	r, _ := Open(dir)
+
+	// Changed before the baseline reached it
+	r.Change("a.txt")
+	os.WriteFile(f, []byte("a\nb\n"), 0644)
+	r.LoadBaseline([]string{"a.txt"}, DefaultBaselineMaxSize, time.Now())
+
+	c, _ := r.Change("a.txt")
+	if c.Before != "a\n" || c.Diff.Stats.Added != 1 {
+		t.Errorf("expected the diff to continue from the last snapshot, got %q %+v", c.Before, c.Diff.Stats)
+	}
+}
+
+func TestBaselineSkipsFilesModifiedSinceStart(t *testing.T) {
+	dir := t.TempDir()
+	f := filepath.Join(dir, "a.txt")
+	os.WriteFile(f, []byte("a\n"), 0644)
+	r, _ := Open(dir)
+	start := time.Now()
+
+	// Edited by the agent after watching started, before the baseline read
+	// it or its event was diffed
+	later := start.Add(time.Second)
+	os.WriteFile(f, []byte("a\nb\n"), 0644)
+	os.Chtimes(f, later, later)
+	r.LoadBaseline([]string{"a.txt"}, DefaultBaselineMaxSize, start)
+
+	if c, _ := r.Change("a.txt"); c.BeforeExists || c.Diff.Stats.Added != 2 {
+		t.Errorf("expected the edit not to become the baseline, got before %q %+v", c.Before, c.Diff.Stats)
+	}
+}
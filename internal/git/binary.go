@@ -0,0 +1,232 @@
+package git
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	_ "image/gif" // register decoders for image dimensions
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/wgawan/agent-spy/internal/types"
+)
+
+// MaxDiffSize is the largest file, in bytes, that is diffed line by line.
+// Larger files are summarized by size and hash without being read into
+// memory.
+var MaxDiffSize int64 = 4 << 20
+
+// sniffLen is how much of a file is checked for NUL bytes to decide whether
+// it's binary, as git does.
+const sniffLen = 8000
+
+// binaryInfo is what's kept of a binary or oversized file to summarize its
+// changes.
+type binaryInfo struct {
+	kind    string // a types.Binary* kind, or "" for text
+	size    int64
+	sum     string            // SHA-256, hex
+	dims    string            // images
+	entries map[string]string // archives: entry name → size and checksum
+}
+
+// load reads the file at path into a snapshot. Text files are kept whole.
+// Binary files are summarized, and also kept whole so the session patch can
+// include them, unless they are over MaxDiffSize.
+func load(path string) (base, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return base{}, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return base{}, err
+	}
+	if info.IsDir() {
+		return base{}, fmt.Errorf("%s is a directory", path)
+	}
+
+	if info.Size() > MaxDiffSize {
+		bin, err := summarize(f, info.Size())
+		if err != nil {
+			return base{}, err
+		}
+		return base{exists: true, bin: bin, partial: true}, nil
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return base{}, err
+	}
+	return loaded(string(data)), nil
+}
+
+// loaded makes a snapshot of content that's already in memory, summarizing
+// it if it's binary.
+func loaded(content string) base {
+	b := base{content: content, exists: true}
+	if isBinary([]byte(content)) {
+		b.bin, _ = summarize(strings.NewReader(content), int64(len(content)))
+	}
+	return b
+}
+
+func isBinary(data []byte) bool {
+	if len(data) > sniffLen {
+		data = data[:sniffLen]
+	}
+	return bytes.IndexByte(data, 0) >= 0
+}
+
+// summarize hashes the size bytes of r and works out what kind of file they
+// are, reading only the parts it needs beyond that.
+func summarize(r io.ReaderAt, size int64) (*binaryInfo, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, io.NewSectionReader(r, 0, size)); err != nil {
+		return nil, err
+	}
+	info := &binaryInfo{size: size, sum: hex.EncodeToString(h.Sum(nil))}
+
+	head := make([]byte, sniffLen)
+	n, _ := r.ReadAt(head, 0)
+	head = head[:n]
+
+	if cfg, _, err := image.DecodeConfig(io.NewSectionReader(r, 0, size)); err == nil {
+		info.kind = types.BinaryImage
+		info.dims = fmt.Sprintf("%dx%d", cfg.Width, cfg.Height)
+		return info, nil
+	}
+	if entries, ok := archiveEntries(r, size, head); ok {
+		info.kind = types.BinaryArchive
+		info.entries = entries
+		return info, nil
+	}
+	switch {
+	case isBinary(head):
+		info.kind = types.BinaryGeneric
+	case size > MaxDiffSize:
+		info.kind = types.BinaryLarge
+	}
+	return info, nil
+}
+
+// archiveEntries lists the entries of a zip (including jar and similar),
+// tar or gzipped tar archive.
+func archiveEntries(r io.ReaderAt, size int64, head []byte) (map[string]string, bool) {
+	switch {
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")), bytes.HasPrefix(head, []byte("PK\x05\x06")):
+		zr, err := zip.NewReader(r, size)
+		if err != nil {
+			return nil, false
+		}
+		entries := make(map[string]string, len(zr.File))
+		for _, f := range zr.File {
+			entries[f.Name] = fmt.Sprintf("%d %08x", f.UncompressedSize64, f.CRC32)
+		}
+		return entries, true
+	case bytes.HasPrefix(head, []byte{0x1f, 0x8b}):
+		gz, err := gzip.NewReader(io.NewSectionReader(r, 0, size))
+		if err != nil {
+			return nil, false
+		}
+		defer gz.Close()
+		return tarEntries(gz)
+	case len(head) > 262 && string(head[257:262]) == "ustar":
+		return tarEntries(io.NewSectionReader(r, 0, size))
+	}
+	return nil, false
+}
+
+func tarEntries(r io.Reader) (map[string]string, bool) {
+	tr := tar.NewReader(r)
+	entries := make(map[string]string)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return entries, true
+		}
+		if err != nil {
+			return nil, false // not a tar after all, or truncated
+		}
+		entries[hdr.Name] = fmt.Sprintf("%d %d", hdr.Size, hdr.ModTime.Unix())
+	}
+}
+
+// summary returns b's binary summary, computing one for text content.
+func (b base) summary() *binaryInfo {
+	if b.bin != nil {
+		return b.bin
+	}
+	info, _ := summarize(strings.NewReader(b.content), int64(len(b.content)))
+	return info
+}
+
+// binaryDiff summarizes the change from old to cur, either of which is
+// binary or too large to diff.
+func binaryDiff(old, cur base) types.DiffResult {
+	d := &types.BinaryDiff{}
+	var o, n *binaryInfo
+	if old.exists {
+		o = old.summary()
+		d.OldSize, d.OldHash, d.OldDims = o.size, o.sum, o.dims
+		d.Kind = o.kind
+	}
+	if cur.exists {
+		n = cur.summary()
+		d.NewSize, d.NewHash, d.NewDims = n.size, n.sum, n.dims
+		if n.kind != "" {
+			d.Kind = n.kind
+		}
+	}
+	if o != nil && n != nil && o.sum == n.sum {
+		return types.DiffResult{Available: false, Error: "no changes"}
+	}
+	if d.Kind == "" {
+		d.Kind = types.BinaryGeneric
+	}
+	if d.Kind == types.BinaryArchive {
+		var oldEntries, newEntries map[string]string
+		if o != nil {
+			oldEntries = o.entries
+		}
+		if n != nil {
+			newEntries = n.entries
+		}
+		d.Added, d.Removed, d.Changed = compareEntries(oldEntries, newEntries)
+	}
+	msg := "binary file changed"
+	if d.Kind == types.BinaryLarge {
+		msg = "file too large to diff"
+	}
+	return types.DiffResult{Available: false, Error: msg, Binary: d}
+}
+
+func compareEntries(old, cur map[string]string) (added, removed, changed []string) {
+	for name, desc := range cur {
+		prev, ok := old[name]
+		switch {
+		case !ok:
+			added = append(added, name)
+		case prev != desc:
+			changed = append(changed, name)
+		}
+	}
+	for name := range old {
+		if _, ok := cur[name]; !ok {
+			removed = append(removed, name)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	sort.Strings(changed)
+	return added, removed, changed
+}
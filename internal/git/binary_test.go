@@ -0,0 +1,128 @@
+package git
+
+import (
+	"archive/zip"
+	"bytes"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/wgawan/agent-spy/internal/types"
+)
+
+func writePNG(t *testing.T, path string, w, h int) {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, w, h))); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(path, buf.Bytes(), 0644)
+}
+
+func writeZip(t *testing.T, path string, files map[string]string) {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		f, _ := zw.Create(name)
+		f.Write([]byte(content))
+	}
+	zw.Close()
+	os.WriteFile(path, buf.Bytes(), 0644)
+}
+
+func TestDiffImage(t *testing.T) {
+	dir := t.TempDir()
+	r, _ := Open(dir)
+	logo := filepath.Join(dir, "logo.png")
+
+	writePNG(t, logo, 16, 16)
+	r.Diff("logo.png")
+	writePNG(t, logo, 32, 24)
+	diff, _ := r.Diff("logo.png")
+
+	if diff.Available || diff.Binary == nil {
+		t.Fatalf("expected a binary summary, got %+v", diff)
+	}
+	b := diff.Binary
+	if b.Kind != types.BinaryImage || b.OldDims != "16x16" || b.NewDims != "32x24" {
+		t.Errorf("unexpected image summary %+v", b)
+	}
+	if b.OldHash == "" || b.OldHash == b.NewHash || b.NewSize == 0 {
+		t.Errorf("expected sizes and differing hashes, got %+v", b)
+	}
+	if got := diff.Unified("logo.png"); got != "Binary files a/logo.png and b/logo.png differ\n" {
+		t.Errorf("unexpected unified output %q", got)
+	}
+}
+
+func TestDiffArchiveEntries(t *testing.T) {
+	dir := t.TempDir()
+	r, _ := Open(dir)
+	jar := filepath.Join(dir, "app.jar")
+
+	writeZip(t, jar, map[string]string{"Main.class": "v1", "Old.class": "x", "META-INF/MANIFEST.MF": "m"})
+	r.Diff("app.jar")
+	writeZip(t, jar, map[string]string{"Main.class": "v2", "New.class": "y", "META-INF/MANIFEST.MF": "m"})
+	diff, _ := r.Diff("app.jar")
+
+	b := diff.Binary
+	if b == nil || b.Kind != types.BinaryArchive {
+		t.Fatalf("expected an archive summary, got %+v", diff)
+	}
+	if !reflect.DeepEqual(b.Added, []string{"New.class"}) ||
+		!reflect.DeepEqual(b.Removed, []string{"Old.class"}) ||
+		!reflect.DeepEqual(b.Changed, []string{"Main.class"}) {
+		t.Errorf("unexpected entry changes %+v", b)
+	}
+}
+
+func TestDiffBinaryUnchanged(t *testing.T) {
+	dir := t.TempDir()
+	r, _ := Open(dir)
+	f := filepath.Join(dir, "blob.bin")
+	os.WriteFile(f, []byte("a\x00b"), 0644)
+
+	diff, _ := r.Diff("blob.bin")
+	if diff.Binary == nil || diff.Binary.Kind != types.BinaryGeneric || diff.Binary.OldHash != "" || diff.Binary.NewSize != 3 {
+		t.Fatalf("expected a created binary, got %+v", diff)
+	}
+	if got := diff.Unified("blob.bin"); !strings.HasPrefix(got, "Binary files /dev/null and b/blob.bin") {
+		t.Errorf("unexpected unified output %q", got)
+	}
+
+	os.WriteFile(f, []byte("a\x00b"), 0644)
+	if diff, _ := r.Diff("blob.bin"); diff.Binary != nil || diff.Error != "no changes" {
+		t.Errorf("expected no changes, got %+v", diff)
+	}
+}
+
+func TestDiffLargeFile(t *testing.T) {
+	defer func(n int64) { MaxDiffSize = n }(MaxDiffSize)
+	MaxDiffSize = 64
+
+	dir := t.TempDir()
+	r, _ := Open(dir)
+	f := filepath.Join(dir, "dump.sql")
+	os.WriteFile(f, []byte(strings.Repeat("insert;\n", 10)), 0644)
+	r.Change("dump.sql")
+	os.WriteFile(f, []byte(strings.Repeat("insert;\n", 20)), 0644)
+
+	c, _ := r.Change("dump.sql")
+	if c.Diff.Binary == nil || c.Diff.Binary.Kind != types.BinaryLarge || c.Diff.Error != "file too large to diff" {
+		t.Fatalf("expected a large file summary, got %+v", c.Diff)
+	}
+	if c.Before != "" || c.After != "" {
+		t.Error("expected the content not to be kept")
+	}
+	if c.BeforeSum == "" || c.AfterSum == "" || c.BeforeSum == c.AfterSum {
+		t.Errorf("expected differing hashes, got %q and %q", c.BeforeSum, c.AfterSum)
+	}
+	if b := c.Diff.Binary; b.OldSize != 80 || b.NewSize != 160 {
+		t.Errorf("unexpected sizes %+v", b)
+	}
+}
@@ -0,0 +1,455 @@
+package git
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/wgawan/agent-spy/internal/types"
+)
+
+// CheckpointRefPrefix is the namespace checkpoint refs are written under.
+const CheckpointRefPrefix = "refs/agent-spy/"
+
+// Checkpoint is a snapshot of the working tree stored as a commit under a
+// hidden ref. N counts from 1 within a session; 0 refers to the state the
+// session started from.
+type Checkpoint struct {
+	N     int       `json:"n"`
+	Ref   string    `json:"ref"`
+	Hash  string    `json:"hash"`
+	Time  time.Time `json:"time"`
+	Files int       `json:"files"` // files changed since the previous checkpoint
+}
+
+type CheckpointConfig struct {
+	Session string        // ref namespace; defaults to the start time
+	Quiet   time.Duration // how long activity must pause before a checkpoint is taken
+	OnError func(error)   // called when a background checkpoint fails
+}
+
+// Checkpointer snapshots the working tree into refs/agent-spy/<session>/<n>.
+// Objects are written straight to the object database, so the index, HEAD
+// and branches are never touched. The whole worktree is captured, even when
+// only a subdirectory is watched; submodules are left out.
+type Checkpointer struct {
+	repo *Repo
+	cfg  CheckpointConfig
+
+	mu       sync.Mutex
+	list     []Checkpoint
+	baseTree plumbing.Hash // tree the session started from (zero if none)
+	lastTree plumbing.Hash
+	parent   plumbing.Hash
+	blobs    map[string]cachedBlob
+}
+
+// cachedBlob lets unchanged files skip re-hashing between checkpoints.
+type cachedBlob struct {
+	size    int64
+	modTime time.Time
+	mode    filemode.FileMode
+	hash    plumbing.Hash
+}
+
+func NewCheckpointer(r *Repo, cfg CheckpointConfig) (*Checkpointer, error) {
+	if r.repo == nil {
+		return nil, errors.New("checkpoints require a git repository")
+	}
+	if cfg.Session == "" {
+		cfg.Session = time.Now().Format("20060102-150405")
+	}
+	c := &Checkpointer{repo: r, cfg: cfg, blobs: make(map[string]cachedBlob)}
+	if ref, err := r.repo.Head(); err == nil {
+		c.parent = ref.Hash()
+		if commit, err := r.repo.CommitObject(ref.Hash()); err == nil {
+			c.baseTree = commit.TreeHash
+			c.lastTree = commit.TreeHash
+		}
+	}
+	return c, nil
+}
+
+// Session returns the name checkpoints are grouped under.
+func (c *Checkpointer) Session() string {
+	return c.cfg.Session
+}
+
+// List returns the checkpoints taken so far, oldest first.
+func (c *Checkpointer) List() []Checkpoint {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Checkpoint(nil), c.list...)
+}
+
+// Run takes a checkpoint whenever records stop arriving for the quiet
+// period, and once more when records is closed if anything changed since
+// the last one.
+func (c *Checkpointer) Run(records <-chan types.Record) {
+	timer := time.NewTimer(c.cfg.Quiet)
+	timer.Stop()
+	dirty := false
+	for {
+		select {
+		case _, ok := <-records:
+			if !ok {
+				timer.Stop()
+				if dirty {
+					c.save()
+				}
+				return
+			}
+			dirty = true
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(c.cfg.Quiet)
+		case <-timer.C:
+			dirty = false
+			c.save()
+		}
+	}
+}
+
+func (c *Checkpointer) save() {
+	if _, _, err := c.Save(); err != nil && c.cfg.OnError != nil {
+		c.cfg.OnError(err)
+	}
+}
+
+// Save snapshots the working tree now. It reports false, without creating a
+// checkpoint, if nothing changed since the last one.
+func (c *Checkpointer) Save() (Checkpoint, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	tree, err := c.writeTree()
+	if err != nil {
+		return Checkpoint{}, false, err
+	}
+	if tree == c.lastTree {
+		return Checkpoint{}, false, nil
+	}
+	changed, err := c.changes(c.lastTree, tree)
+	if err != nil {
+		return Checkpoint{}, false, err
+	}
+
+	n := len(c.list) + 1
+	now := time.Now()
+	sig := object.Signature{Name: "agent-spy", Email: "agent-spy@localhost", When: now}
+	commit := &object.Commit{
+		Author:    sig,
+		Committer: sig,
+		Message:   fmt.Sprintf("agent-spy checkpoint %d (session %s)\n", n, c.cfg.Session),
+		TreeHash:  tree,
+	}
+	if !c.parent.IsZero() {
+		commit.ParentHashes = []plumbing.Hash{c.parent}
+	}
+	hash, err := c.store(commit)
+	if err != nil {
+		return Checkpoint{}, false, err
+	}
+	name := plumbing.ReferenceName(fmt.Sprintf("%s%s/%d", CheckpointRefPrefix, c.cfg.Session, n))
+	if err := c.repo.repo.Storer.SetReference(plumbing.NewHashReference(name, hash)); err != nil {
+		return Checkpoint{}, false, err
+	}
+
+	cp := Checkpoint{N: n, Ref: name.String(), Hash: hash.String(), Time: now, Files: len(changed)}
+	c.list = append(c.list, cp)
+	c.lastTree = tree
+	c.parent = hash
+	return cp, true, nil
+}
+
+// Diff returns a unified diff between two checkpoints.
+func (c *Checkpointer) Diff(from, to int) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	changes, err := c.changes(c.treeHash(from), c.treeHash(to))
+	if err != nil {
+		return "", err
+	}
+	patch, err := changes.Patch()
+	if err != nil {
+		return "", err
+	}
+	return patch.String(), nil
+}
+
+// Restore makes the working tree match checkpoint n. Ignored files are left
+// alone. The current state is checkpointed first so a restore can be undone.
+func (c *Checkpointer) Restore(n int) error {
+	if n < 1 || n > len(c.List()) {
+		return fmt.Errorf("no checkpoint %d", n)
+	}
+	if _, _, err := c.Save(); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	tree, err := object.GetTree(c.repo.repo.Storer, c.treeHash(n))
+	if err != nil {
+		return err
+	}
+	current, err := c.walk()
+	if err != nil {
+		return err
+	}
+
+	want := make(map[string]bool)
+	err = tree.Files().ForEach(func(f *object.File) error {
+		want[f.Name] = true
+		if cur, ok := current[f.Name]; ok && cur.hash == f.Hash && cur.mode == f.Mode {
+			return nil
+		}
+		return c.restoreFile(f)
+	})
+	if err != nil {
+		return err
+	}
+	for path := range current {
+		if !want[path] {
+			if err := os.Remove(filepath.Join(c.repo.root, filepath.FromSlash(path))); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			c.removeEmptyDirs(filepath.Dir(filepath.FromSlash(path)))
+		}
+	}
+	return nil
+}
+
+func (c *Checkpointer) restoreFile(f *object.File) error {
+	abs := filepath.Join(c.repo.root, filepath.FromSlash(f.Name))
+	reader, err := f.Reader()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(abs), 0755); err != nil {
+		return err
+	}
+	os.Remove(abs)
+	if f.Mode == filemode.Symlink {
+		return os.Symlink(string(content), abs)
+	}
+	perm := os.FileMode(0644)
+	if f.Mode == filemode.Executable {
+		perm = 0755
+	}
+	return os.WriteFile(abs, content, perm)
+}
+
+func (c *Checkpointer) removeEmptyDirs(rel string) {
+	for rel != "." && rel != string(filepath.Separator) {
+		if os.Remove(filepath.Join(c.repo.root, rel)) != nil {
+			return
+		}
+		rel = filepath.Dir(rel)
+	}
+}
+
+// treeHash returns the tree of checkpoint n, where 0 is the session start.
+func (c *Checkpointer) treeHash(n int) plumbing.Hash {
+	if n < 1 || n > len(c.list) {
+		return c.baseTree
+	}
+	commit, err := c.repo.repo.CommitObject(plumbing.NewHash(c.list[n-1].Hash))
+	if err != nil {
+		return plumbing.ZeroHash
+	}
+	return commit.TreeHash
+}
+
+func (c *Checkpointer) changes(from, to plumbing.Hash) (object.Changes, error) {
+	var a, b *object.Tree
+	var err error
+	if !from.IsZero() {
+		if a, err = object.GetTree(c.repo.repo.Storer, from); err != nil {
+			return nil, err
+		}
+	}
+	if !to.IsZero() {
+		if b, err = object.GetTree(c.repo.repo.Storer, to); err != nil {
+			return nil, err
+		}
+	}
+	return object.DiffTree(a, b)
+}
+
+// walk hashes every non-ignored file in the working tree, writing new blobs
+// to the object database. Paths use forward slashes.
+func (c *Checkpointer) walk() (map[string]cachedBlob, error) {
+	var patterns []gitignore.Pattern
+	if wt, err := c.repo.repo.Worktree(); err == nil {
+		patterns, _ = gitignore.ReadPatterns(wt.Filesystem, nil)
+	}
+	matcher := gitignore.NewMatcher(patterns)
+
+	files := make(map[string]cachedBlob)
+	err := filepath.WalkDir(c.repo.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == c.repo.root {
+				return err
+			}
+			return nil // vanished mid-walk
+		}
+		rel, _ := filepath.Rel(c.repo.root, path)
+		if rel == "." {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		if d.IsDir() {
+			if d.Name() == ".git" || matcher.Match(strings.Split(rel, "/"), true) {
+				return filepath.SkipDir
+			}
+			if _, err := os.Lstat(filepath.Join(path, ".git")); err == nil {
+				return filepath.SkipDir // submodule or nested repository
+			}
+			return nil
+		}
+		if matcher.Match(strings.Split(rel, "/"), false) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		blob, err := c.blob(path, rel, info)
+		if err != nil {
+			return nil
+		}
+		files[rel] = blob
+		return nil
+	})
+	return files, err
+}
+
+func (c *Checkpointer) blob(abs, rel string, info fs.FileInfo) (cachedBlob, error) {
+	mode := filemode.Regular
+	switch {
+	case info.Mode()&fs.ModeSymlink != 0:
+		mode = filemode.Symlink
+	case !info.Mode().IsRegular():
+		return cachedBlob{}, errors.New("not a regular file")
+	case info.Mode()&0111 != 0:
+		mode = filemode.Executable
+	}
+	if cached, ok := c.blobs[rel]; ok && cached.size == info.Size() &&
+		cached.modTime.Equal(info.ModTime()) && cached.mode == mode {
+		return cached, nil
+	}
+
+	var content []byte
+	var err error
+	if mode == filemode.Symlink {
+		var target string
+		target, err = os.Readlink(abs)
+		content = []byte(target)
+	} else {
+		content, err = os.ReadFile(abs)
+	}
+	if err != nil {
+		return cachedBlob{}, err
+	}
+
+	obj := c.repo.repo.Storer.NewEncodedObject()
+	obj.SetType(plumbing.BlobObject)
+	w, err := obj.Writer()
+	if err != nil {
+		return cachedBlob{}, err
+	}
+	if _, err := io.Copy(w, bytes.NewReader(content)); err != nil {
+		w.Close()
+		return cachedBlob{}, err
+	}
+	w.Close()
+	hash, err := c.repo.repo.Storer.SetEncodedObject(obj)
+	if err != nil {
+		return cachedBlob{}, err
+	}
+	b := cachedBlob{size: info.Size(), modTime: info.ModTime(), mode: mode, hash: hash}
+	c.blobs[rel] = b
+	return b, nil
+}
+
+// writeTree stores the working tree as nested tree objects and returns the
+// root tree's hash.
+func (c *Checkpointer) writeTree() (plumbing.Hash, error) {
+	files, err := c.walk()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	root := &treeNode{children: make(map[string]*treeNode)}
+	for path, blob := range files {
+		node := root
+		parts := strings.Split(path, "/")
+		for _, dir := range parts[:len(parts)-1] {
+			child, ok := node.children[dir]
+			if !ok {
+				child = &treeNode{children: make(map[string]*treeNode)}
+				node.children[dir] = child
+			}
+			node = child
+		}
+		node.files = append(node.files, object.TreeEntry{Name: parts[len(parts)-1], Mode: blob.mode, Hash: blob.hash})
+	}
+	return c.storeTree(root)
+}
+
+type treeNode struct {
+	files    []object.TreeEntry
+	children map[string]*treeNode
+}
+
+func (c *Checkpointer) storeTree(n *treeNode) (plumbing.Hash, error) {
+	entries := append([]object.TreeEntry(nil), n.files...)
+	for name, child := range n.children {
+		hash, err := c.storeTree(child)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		entries = append(entries, object.TreeEntry{Name: name, Mode: filemode.Dir, Hash: hash})
+	}
+	// Git orders entries as if directory names ended in "/".
+	key := func(e object.TreeEntry) string {
+		if e.Mode == filemode.Dir {
+			return e.Name + "/"
+		}
+		return e.Name
+	}
+	sort.Slice(entries, func(i, j int) bool { return key(entries[i]) < key(entries[j]) })
+	return c.store(&object.Tree{Entries: entries})
+}
+
+func (c *Checkpointer) store(o interface {
+	Encode(plumbing.EncodedObject) error
+}) (plumbing.Hash, error) {
+	obj := c.repo.repo.Storer.NewEncodedObject()
+	if err := o.Encode(obj); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return c.repo.repo.Storer.SetEncodedObject(obj)
+}
@@ -0,0 +1,119 @@
+package git
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wgawan/agent-spy/internal/types"
+)
+
+func TestCheckpointSaveAndDiff(t *testing.T) {
+	dir := initTestRepo(t)
+	os.WriteFile(filepath.Join(dir, ".gitignore"), []byte("*.log\n"), 0644)
+	r, _ := Open(dir)
+	c, err := NewCheckpointer(r, CheckpointConfig{Session: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	os.MkdirAll(filepath.Join(dir, "src"), 0755)
+	os.WriteFile(filepath.Join(dir, "src", "app.go"), []byte("package main\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "debug.log"), []byte("noise\n"), 0644)
+	first, ok, err := c.Save()
+	if err != nil || !ok {
+		t.Fatalf("Save() = %v, %v", ok, err)
+	}
+	if first.N != 1 || first.Ref != "refs/agent-spy/test/1" || first.Files != 2 {
+		t.Errorf("unexpected checkpoint %+v", first)
+	}
+	if _, ok, _ := c.Save(); ok {
+		t.Error("expected no checkpoint when nothing changed")
+	}
+
+	os.WriteFile(filepath.Join(dir, "src", "app.go"), []byte("package main\n\nfunc main() {}\n"), 0644)
+	if _, ok, _ := c.Save(); !ok {
+		t.Fatal("expected a second checkpoint")
+	}
+
+	diff, err := c.Diff(1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(diff, "+func main() {}") || strings.Contains(diff, "debug.log") {
+		t.Errorf("unexpected diff:\n%s", diff)
+	}
+
+	// The ref resolves for plain git, and the branch and index are untouched.
+	out, err := exec.Command("git", "-C", dir, "show", "refs/agent-spy/test/2:src/app.go").Output()
+	if err != nil || !strings.Contains(string(out), "func main") {
+		t.Errorf("git show on checkpoint ref: %v %q", err, out)
+	}
+	status, _ := exec.Command("git", "-C", dir, "status", "--porcelain").Output()
+	if strings.Contains(string(status), "A ") {
+		t.Errorf("expected nothing staged, got %q", status)
+	}
+}
+
+func TestCheckpointRestore(t *testing.T) {
+	dir := initTestRepo(t)
+	r, _ := Open(dir)
+	c, _ := NewCheckpointer(r, CheckpointConfig{Session: "test"})
+	app := filepath.Join(dir, "app.go")
+
+	os.WriteFile(app, []byte("v1\n"), 0644)
+	c.Save()
+	os.WriteFile(app, []byte("v2\n"), 0644)
+	os.MkdirAll(filepath.Join(dir, "tmp"), 0755)
+	os.WriteFile(filepath.Join(dir, "tmp", "extra.txt"), []byte("x\n"), 0644)
+
+	if err := c.Restore(1); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(app); string(got) != "v1\n" {
+		t.Errorf("expected app.go restored to v1, got %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "tmp")); !os.IsNotExist(err) {
+		t.Error("expected files added after the checkpoint to be removed")
+	}
+	// The pre-restore state was saved, so the restore can be undone.
+	if cps := c.List(); len(cps) != 2 {
+		t.Fatalf("expected a checkpoint of the pre-restore state, got %d", len(cps))
+	}
+	c.Restore(2)
+	if got, _ := os.ReadFile(app); string(got) != "v2\n" {
+		t.Errorf("expected undo to bring back v2, got %q", got)
+	}
+}
+
+func TestCheckpointRunWaitsForQuiet(t *testing.T) {
+	dir := initTestRepo(t)
+	r, _ := Open(dir)
+	c, _ := NewCheckpointer(r, CheckpointConfig{Session: "test", Quiet: 50 * time.Millisecond})
+
+	records := make(chan types.Record)
+	done := make(chan struct{})
+	go func() {
+		c.Run(records)
+		close(done)
+	}()
+
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a\n"), 0644)
+	records <- types.Record{}
+	records <- types.Record{}
+	time.Sleep(200 * time.Millisecond)
+	if n := len(c.List()); n != 1 {
+		t.Fatalf("expected one checkpoint after the burst, got %d", n)
+	}
+
+	os.WriteFile(filepath.Join(dir, "b.txt"), []byte("b\n"), 0644)
+	records <- types.Record{}
+	close(records)
+	<-done
+	if n := len(c.List()); n != 2 {
+		t.Errorf("expected a final checkpoint on close, got %d", n)
+	}
+}
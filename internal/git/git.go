@@ -7,28 +7,200 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	gogit "github.com/go-git/go-git/v5"
 	"github.com/wgawan/agent-spy/internal/types"
 )
 
+// Repo is safe for concurrent use, but changes to the same file must be
+// requested in order for its snapshot chain to stay correct.
+//
+// File paths passed to and returned from a Repo are relative to the watched
+// path, which may be anywhere inside the worktree.
 type Repo struct {
 	repo      *gogit.Repository
-	path      string
-	snapshots map[string]string // file path -> content at last event
+	path      string // watched directory
+	root      string // top of the worktree containing path
+	prefix    string // path relative to root, slash-separated; "" at the top
+	gitDir    string // .git directory (per worktree for linked worktrees)
+	commonDir string // directory holding refs and objects
+	mu        sync.Mutex
+	snapshots map[string]base  // file path -> content at last event
+	bases     map[string]base  // file path -> content before its first event
+	owners    map[string]*Repo // directory -> nested repo (submodule) owning it
+	baseline  *baseline        // content at startup, if loaded
 }
 
+// base is a file's content at some point in the session.
+type base struct {
+	content string
+	exists  bool
+	bin     *binaryInfo // set for binary files and files over MaxDiffSize
+	partial bool        // over MaxDiffSize: content isn't kept
+}
+
+// same reports whether b and o hold the same content.
+func (b base) same(o base) bool {
+	if b.exists != o.exists || b.partial != o.partial {
+		return false
+	}
+	if b.partial {
+		return b.bin.sum == o.bin.sum
+	}
+	return b.content == o.content
+}
+
+// Open finds the repository containing path, searching parent directories
+// like git does. Linked worktrees and submodules (whose .git is a file) are
+// supported; a bare repository has no worktree to diff and is treated as no
+// repository.
 func Open(path string) (*Repo, error) {
-	r := &Repo{path: path, snapshots: make(map[string]string)}
-	repo, err := gogit.PlainOpen(path)
+	r := OpenDir(path)
+	repo, err := gogit.PlainOpenWithOptions(path, &gogit.PlainOpenOptions{
+		DetectDotGit:          true,
+		EnableDotGitCommonDir: true,
+	})
 	if err != nil {
 		// Not a git repo - that's fine, gracefully degrade
 		return r, nil
 	}
+	wt, err := repo.Worktree()
+	if err != nil {
+		return r, nil // bare
+	}
 	r.repo = repo
+	r.root = wt.Filesystem.Root()
+	if prefix, err := relPath(r.root, path); err == nil && prefix != "." {
+		r.prefix = prefix
+	}
+	r.gitDir, r.commonDir = resolveGitDirs(r.root)
 	return r, nil
 }
 
+// OpenDir returns a Repo for path that ignores any repository around it.
+// It diffs files against their snapshots and baseline only.
+func OpenDir(path string) *Repo {
+	return &Repo{
+		path:      path,
+		root:      path,
+		snapshots: make(map[string]base),
+		bases:     make(map[string]base),
+		owners:    make(map[string]*Repo),
+	}
+}
+
+// relPath is filepath.Rel with symlinks resolved (so /tmp and /private/tmp
+// agree) and slash separators.
+func relPath(base, target string) (string, error) {
+	if b, err := filepath.EvalSymlinks(base); err == nil {
+		base = b
+	}
+	if t, err := filepath.EvalSymlinks(target); err == nil {
+		target = t
+	}
+	rel, err := filepath.Rel(base, target)
+	return filepath.ToSlash(rel), err
+}
+
+// resolveGitDirs locates the git directory of the worktree at root. In a
+// linked worktree or submodule .git is a file pointing elsewhere, and refs
+// live in the common directory named by its commondir file.
+func resolveGitDirs(root string) (gitDir, commonDir string) {
+	gitDir = filepath.Join(root, ".git")
+	if data, err := os.ReadFile(gitDir); err == nil {
+		if line := strings.TrimSpace(string(data)); strings.HasPrefix(line, "gitdir: ") {
+			dir := strings.TrimPrefix(line, "gitdir: ")
+			if !filepath.IsAbs(dir) {
+				dir = filepath.Join(root, dir)
+			}
+			gitDir = filepath.Clean(dir)
+		}
+	}
+	commonDir = gitDir
+	if data, err := os.ReadFile(filepath.Join(gitDir, "commondir")); err == nil {
+		dir := strings.TrimSpace(string(data))
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(gitDir, dir)
+		}
+		commonDir = filepath.Clean(dir)
+	}
+	return gitDir, commonDir
+}
+
+// repoPath translates a path relative to the watched directory into one
+// relative to the worktree root, as git expects in "HEAD:<path>".
+func (r *Repo) repoPath(rel string) string {
+	rel = filepath.ToSlash(rel)
+	if r.prefix == "" {
+		return rel
+	}
+	return r.prefix + "/" + rel
+}
+
+// watchPath is the inverse of repoPath. It reports false for paths outside
+// the watched directory.
+func (r *Repo) watchPath(repoRel string) (string, bool) {
+	if r.prefix == "" {
+		return filepath.FromSlash(repoRel), true
+	}
+	if !strings.HasPrefix(repoRel, r.prefix+"/") {
+		return "", false
+	}
+	return filepath.FromSlash(strings.TrimPrefix(repoRel, r.prefix+"/")), true
+}
+
+// owner returns the repository that tracks relPath: a submodule or other
+// nested repository if the file is inside one, otherwise r. The returned
+// path is relative to the owner's root.
+func (r *Repo) owner(relPath string) (*Repo, string) {
+	abs := filepath.Join(r.path, relPath)
+	for dir := filepath.Dir(abs); dir != r.root && strings.HasPrefix(dir, r.root); dir = filepath.Dir(dir) {
+		if sub := r.nestedRepo(dir); sub != nil {
+			rel, err := filepath.Rel(dir, abs)
+			if err != nil {
+				break
+			}
+			return sub, rel
+		}
+	}
+	return r, relPath
+}
+
+// nestedRepo returns the repository rooted at dir, if there is one.
+func (r *Repo) nestedRepo(dir string) *Repo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if sub, ok := r.owners[dir]; ok {
+		return sub
+	}
+	var sub *Repo
+	if _, err := os.Lstat(filepath.Join(dir, ".git")); err == nil {
+		if s, _ := Open(dir); s.Available() {
+			sub = s
+		}
+	}
+	r.owners[dir] = sub
+	return sub
+}
+
+// nestedRepos returns the nested repositories found so far, keyed by their
+// path relative to the watched directory.
+func (r *Repo) nestedRepos() map[string]*Repo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	subs := make(map[string]*Repo)
+	for dir, sub := range r.owners {
+		if sub == nil {
+			continue
+		}
+		if rel, err := filepath.Rel(r.path, dir); err == nil && !strings.HasPrefix(rel, "..") {
+			subs[rel] = sub
+		}
+	}
+	return subs
+}
+
 func (r *Repo) Available() bool {
 	return r.repo != nil
 }
@@ -48,57 +220,132 @@ func (r *Repo) Branch() string {
 	return ref.Hash().String()[:7]
 }
 
+// Head returns the full hash of the HEAD commit, or "" if there is none.
+func (r *Repo) Head() string {
+	if r.repo == nil {
+		return ""
+	}
+	ref, err := r.repo.Head()
+	if err != nil {
+		return ""
+	}
+	return ref.Hash().String()
+}
+
 func (r *Repo) Path() string {
 	return r.path
 }
 
+// Root returns the top of the worktree, which contains Path.
+func (r *Repo) Root() string {
+	return r.root
+}
+
+// Change is a file's content before and after an event, with the diff
+// between them. Before and After are empty for files over MaxDiffSize.
+type Change struct {
+	Before       string
+	After        string
+	BeforeExists bool
+	AfterExists  bool
+	Diff         types.DiffResult
+
+	// SHA-256 of binary and oversized files; "" for text.
+	BeforeSum string
+	AfterSum  string
+
+	before base
+}
+
 func (r *Repo) Diff(relPath string) (types.DiffResult, error) {
-	// Read current file content
-	absPath := filepath.Join(r.path, relPath)
-	currentBytes, err := os.ReadFile(absPath)
-	if err != nil {
-		// File was deleted
-		prev, hasPrev := r.snapshots[relPath]
-		delete(r.snapshots, relPath)
-		if hasPrev && prev != "" {
-			return r.diffStrings(prev, "", relPath)
-		}
-		return types.DiffResult{Available: false, Error: "file not readable"}, nil
+	c, err := r.Change(relPath)
+	return c.Diff, err
+}
+
+// Change reads the current content of relPath, diffs it against the last
+// snapshot (or the baseline or HEAD the first time the file is seen) and
+// advances the snapshot.
+func (r *Repo) Change(relPath string) (Change, error) {
+	c, err := r.change(relPath)
+	r.mu.Lock()
+	if _, seen := r.bases[relPath]; !seen {
+		r.bases[relPath] = c.before
 	}
-	current := string(currentBytes)
+	r.mu.Unlock()
+	return c, err
+}
 
-	// Get the baseline to diff against
+func (r *Repo) change(relPath string) (Change, error) {
+	// Read current file content, and update the snapshot for next time
+	cur, readErr := load(filepath.Join(r.path, relPath))
+	r.mu.Lock()
 	prev, hasPrev := r.snapshots[relPath]
-
-	// Update snapshot for next time
-	r.snapshots[relPath] = current
-
+	if readErr != nil {
+		delete(r.snapshots, relPath)
+	} else {
+		r.snapshots[relPath] = cur
+	}
+	r.mu.Unlock()
+	if !hasPrev {
+		// First time seeing this file — use its content at startup, or
+		// failing that git HEAD
+		prev, hasPrev = r.baselineBase(relPath)
+	}
 	if !hasPrev {
-		// First time seeing this file — try git HEAD as baseline
-		headContent := r.getHeadContent(relPath)
-		if headContent != "" && headContent != current {
-			return r.diffStrings(headContent, current, relPath)
+		prev, hasPrev = r.headBase(relPath)
+	}
+
+	c := Change{before: prev}
+	if hasPrev {
+		c.Before, c.BeforeExists = prev.content, true
+		if prev.bin != nil {
+			c.BeforeSum = prev.bin.sum
 		}
-		if headContent == current {
-			return types.DiffResult{Available: false, Error: "no changes"}, nil
+	}
+	if readErr == nil {
+		c.After, c.AfterExists = cur.content, true
+		if cur.bin != nil {
+			c.AfterSum = cur.bin.sum
 		}
-		// No HEAD content (untracked/new repo) — show all as additions
-		return r.diffStrings("", current, relPath)
 	}
 
-	if prev == current {
-		return types.DiffResult{Available: false, Error: "no changes"}, nil
+	var err error
+	switch {
+	case readErr != nil && !hasPrev:
+		c.Diff = types.DiffResult{Available: false, Error: "file not readable"}
+	case prev.bin != nil || cur.bin != nil:
+		c.Diff = binaryDiff(prev, cur)
+	case readErr != nil:
+		// File was deleted
+		c.Diff, err = r.diffStrings(prev.content, "", relPath)
+	case prev.content == cur.content:
+		c.Diff = types.DiffResult{Available: false, Error: "no changes"}
+	default:
+		// With no earlier content (untracked/new repo) all lines are additions
+		c.Diff, err = r.diffStrings(prev.content, cur.content, relPath)
 	}
+	return c, err
+}
 
-	return r.diffStrings(prev, current, relPath)
+// headBase returns relPath's content at HEAD, or false if it has none.
+func (r *Repo) headBase(relPath string) (base, bool) {
+	content := r.getHeadContent(relPath)
+	if content == "" {
+		return base{}, false
+	}
+	return stored(content), true
 }
 
-// getHeadContent returns the file content from HEAD, or "" if unavailable.
+// getHeadContent returns the file content from HEAD of the repository that
+// tracks it, or "" if unavailable.
 func (r *Repo) getHeadContent(relPath string) string {
 	if r.repo == nil {
 		return ""
 	}
-	cmd := exec.Command("git", "-C", r.path, "show", "HEAD:"+relPath)
+	if owner, rel := r.owner(relPath); owner != r {
+		return owner.getHeadContent(rel)
+	}
+	cmd := exec.Command("git", "-C", r.root, "show", "HEAD:"+r.repoPath(relPath))
 	out, err := cmd.Output()
 	if err != nil {
 		return ""
@@ -182,6 +429,12 @@ func parseDiffOutput(output string) types.DiffResult {
 	}
 
 	if len(hunks) == 0 {
+		for _, line := range lines {
+			if strings.HasPrefix(line, "Binary files ") {
+				// git's own binary detection; sizes aren't known here
+				return types.DiffResult{Available: false, Error: "binary file changed", Binary: &types.BinaryDiff{Kind: types.BinaryGeneric}}
+			}
+		}
 		return types.DiffResult{Available: false, Error: "no changes"}
 	}
 
@@ -4,6 +4,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -63,6 +64,23 @@ func TestBranchNonRepo(t *testing.T) {
 	}
 }
 
+func TestHead(t *testing.T) {
+	dir := initTestRepo(t)
+	r, _ := Open(dir)
+	out, err := exec.Command("git", "-C", dir, "rev-parse", "HEAD").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := strings.TrimSpace(string(out)); r.Head() != want {
+		t.Errorf("Head() = %q, want %q", r.Head(), want)
+	}
+
+	nonRepo, _ := Open(t.TempDir())
+	if nonRepo.Head() != "" {
+		t.Error("expected empty head for non-repo")
+	}
+}
+
 func TestDiffFirstSeeTrackedFile(t *testing.T) {
 	dir := initTestRepo(t)
 	r, _ := Open(dir)
@@ -218,3 +236,33 @@ func TestGitignorePatternsNonRepo(t *testing.T) {
 		t.Errorf("expected no patterns for non-repo, got %v", patterns)
 	}
 }
+
+func TestChangeBeforeAndAfter(t *testing.T) {
+	dir := initTestRepo(t)
+	r, _ := Open(dir)
+
+	f := filepath.Join(dir, "README.md")
+	os.WriteFile(f, []byte("# Changed\n"), 0644)
+	c, err := r.Change("README.md")
+	if err != nil {
+		t.Fatalf("Change() error: %v", err)
+	}
+	if !c.BeforeExists || c.Before != "# Test\n" {
+		t.Errorf("expected HEAD content as before, got %q (exists=%v)", c.Before, c.BeforeExists)
+	}
+	if !c.AfterExists || c.After != "# Changed\n" {
+		t.Errorf("unexpected after %q (exists=%v)", c.After, c.AfterExists)
+	}
+
+	os.Remove(f)
+	c, _ = r.Change("README.md")
+	if !c.BeforeExists || c.Before != "# Changed\n" {
+		t.Errorf("expected last snapshot as before on delete, got %q", c.Before)
+	}
+	if c.AfterExists {
+		t.Error("expected deleted file to have no after content")
+	}
+	if c.Diff.Stats.Deleted != 1 {
+		t.Errorf("expected 1 deleted line, got %d", c.Diff.Stats.Deleted)
+	}
+}
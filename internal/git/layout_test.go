@@ -0,0 +1,90 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOpenSubdirectory(t *testing.T) {
+	dir := initTestRepo(t)
+	sub := filepath.Join(dir, "pkg", "api")
+	os.MkdirAll(sub, 0755)
+	os.WriteFile(filepath.Join(sub, "api.go"), []byte("package api\n"), 0644)
+	runGit(t, dir, "add", ".")
+	runGit(t, dir, "commit", "-m", "add api")
+
+	r, _ := Open(sub)
+	if !r.Available() {
+		t.Fatal("expected repo to be found from a subdirectory")
+	}
+	os.WriteFile(filepath.Join(sub, "api.go"), []byte("package api\n\nvar X = 1\n"), 0644)
+	diff, _ := r.Diff("api.go")
+	if !diff.Available || diff.Stats.Added != 2 || diff.Stats.Deleted != 0 {
+		t.Errorf("expected diff against HEAD's pkg/api/api.go, got %+v", diff)
+	}
+
+	status, err := r.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := status["api.go"].String(); got != "modified, not staged" {
+		t.Errorf("expected status keyed relative to the watch path, got %v", status)
+	}
+
+	patch, _ := r.SessionPatch(nil)
+	if !strings.Contains(patch, "diff --git a/pkg/api/api.go b/pkg/api/api.go") {
+		t.Errorf("expected patch paths relative to the worktree root:\n%s", patch)
+	}
+}
+
+func TestOpenLinkedWorktree(t *testing.T) {
+	dir := initTestRepo(t)
+	wt := filepath.Join(t.TempDir(), "wt")
+	runGit(t, dir, "worktree", "add", "-q", "-b", "feature", wt)
+
+	r, _ := Open(wt)
+	if !r.Available() || r.Branch() != "feature" {
+		t.Fatalf("expected linked worktree on feature, got available=%v branch=%q", r.Available(), r.Branch())
+	}
+	if !strings.Contains(r.GitDir(), filepath.Join(".git", "worktrees")) {
+		t.Errorf("expected per-worktree git dir, got %s", r.GitDir())
+	}
+	if r.commonDir != filepath.Join(dir, ".git") {
+		t.Errorf("expected common dir %s, got %s", filepath.Join(dir, ".git"), r.commonDir)
+	}
+
+	os.WriteFile(filepath.Join(wt, "README.md"), []byte("# Test\nmore\n"), 0644)
+	diff, _ := r.Diff("README.md")
+	if !diff.Available || diff.Stats.Added != 1 {
+		t.Errorf("expected diff against the worktree's HEAD, got %+v", diff)
+	}
+}
+
+func TestSubmoduleDiffsAgainstOwnHead(t *testing.T) {
+	lib := initTestRepo(t)
+	os.WriteFile(filepath.Join(lib, "lib.go"), []byte("package lib\n"), 0644)
+	runGit(t, lib, "add", ".")
+	runGit(t, lib, "commit", "-m", "lib")
+
+	dir := initTestRepo(t)
+	runGit(t, dir, "-c", "protocol.file.allow=always", "submodule", "-q", "add", lib, "vendor/lib")
+	runGit(t, dir, "commit", "-m", "add submodule")
+
+	r, _ := Open(dir)
+	os.WriteFile(filepath.Join(dir, "vendor", "lib", "lib.go"), []byte("package lib\n\nfunc F() {}\n"), 0644)
+	diff, _ := r.Diff(filepath.Join("vendor", "lib", "lib.go"))
+	if !diff.Available || diff.Stats.Added != 2 || diff.Stats.Deleted != 0 {
+		t.Errorf("expected diff against the submodule's HEAD, got %+v", diff)
+	}
+
+	status, _ := r.Status()
+	if got := status[filepath.Join("vendor", "lib", "lib.go")].String(); got != "modified, not staged" {
+		t.Errorf("expected submodule file status, got %v", status)
+	}
+	vsHead, _ := r.DiffAgainst(filepath.Join("vendor", "lib", "lib.go"), BaseHead)
+	if !vsHead.Available || vsHead.Stats.Added != 2 {
+		t.Errorf("expected working tree diff from the submodule, got %+v", vsHead)
+	}
+}
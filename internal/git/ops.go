@@ -0,0 +1,254 @@
+package git
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/wgawan/agent-spy/internal/types"
+)
+
+// opQuiet is how long .git must be still before its state is read, so a
+// multi-step operation like a rebase is reported once.
+const opQuiet = 150 * time.Millisecond
+
+// OpWatcher reports git operations performed in the repository. It watches
+// HEAD, the index, branch refs and the HEAD reflog, which the rest of the
+// watcher filters out, and sends an OpGit event for each operation.
+type OpWatcher struct {
+	// Root labels events when several roots are watched; set before Start.
+	Root string
+
+	repo   *Repo
+	gitDir string
+	fsw    *fsnotify.Watcher
+	events chan<- types.FileEvent
+	done   chan struct{}
+
+	reflogSize int64
+	head       string
+	branch     string
+}
+
+// GitDir returns the worktree's git directory. For a linked worktree or
+// submodule this is not <root>/.git; HEAD, the index and the HEAD reflog live
+// here, while branch refs live in the common directory.
+func (r *Repo) GitDir() string {
+	return r.gitDir
+}
+
+// WatchOps starts watching the repository for git operations, which are
+// sent on events once Start is called.
+func (r *Repo) WatchOps(events chan<- types.FileEvent) (*OpWatcher, error) {
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	w := &OpWatcher{
+		repo:   r,
+		gitDir: r.GitDir(),
+		fsw:    fsw,
+		events: events,
+		done:   make(chan struct{}),
+	}
+	// logs/ and refs/heads/ may not exist yet in a fresh repo
+	fsw.Add(w.gitDir)
+	fsw.Add(filepath.Join(w.gitDir, "logs"))
+	fsw.Add(filepath.Join(r.commonDir, "refs", "heads"))
+	w.head, w.branch = r.Head(), r.Branch()
+	if info, err := os.Stat(w.reflogPath()); err == nil {
+		w.reflogSize = info.Size()
+	}
+	return w, nil
+}
+
+func (w *OpWatcher) Start() {
+	timer := time.NewTimer(opQuiet)
+	timer.Stop()
+	for {
+		select {
+		case event, ok := <-w.fsw.Events:
+			if !ok {
+				return
+			}
+			if strings.HasSuffix(event.Name, ".lock") {
+				continue
+			}
+			timer.Reset(opQuiet)
+		case _, ok := <-w.fsw.Errors:
+			if !ok {
+				return
+			}
+		case <-timer.C:
+			now := time.Now()
+			for _, op := range w.check() {
+				op := op
+				ev := types.FileEvent{Root: w.Root, Path: filepath.Join(w.Root, ".git"), Op: types.OpGit, Timestamp: now, Git: &op}
+				select {
+				case w.events <- ev:
+				case <-w.done:
+					return
+				}
+			}
+		case <-w.done:
+			return
+		}
+	}
+}
+
+func (w *OpWatcher) Close() {
+	close(w.done)
+	w.fsw.Close()
+}
+
+func (w *OpWatcher) reflogPath() string {
+	return filepath.Join(w.gitDir, "logs", "HEAD")
+}
+
+// check compares the repository with its last known state and describes
+// what happened in between. Reflog entries name the operation; without
+// them, a moved HEAD is still reported.
+func (w *OpWatcher) check() []types.GitOp {
+	head, branch := w.repo.Head(), w.repo.Branch()
+	entries := w.readReflog()
+	prevHead, prevBranch := w.head, w.branch
+	w.head, w.branch = head, branch
+
+	var ops []types.GitOp
+	for _, e := range collapseRebase(entries) {
+		op := describe(e)
+		if op.Kind == "reset" && w.repo.matchesHead() {
+			// The reflog doesn't record the mode, but only --hard leaves
+			// tracked files identical to the new HEAD.
+			op.Summary = "reset --hard" + strings.TrimPrefix(op.Summary, "reset")
+		}
+		op.Head, op.Branch = head, branch
+		ops = append(ops, op)
+	}
+	if len(ops) > 0 {
+		return ops
+	}
+	switch {
+	case branch != prevBranch:
+		return []types.GitOp{{Kind: "checkout", Summary: "checkout " + prevBranch + " → " + branch, Head: head, Branch: branch}}
+	case head != prevHead && head != "":
+		return []types.GitOp{{Kind: "head", Summary: "HEAD moved to " + short(head), Head: head, Branch: branch}}
+	}
+	return nil
+}
+
+// reflogEntry is one line of .git/logs/HEAD.
+type reflogEntry struct {
+	old, new string
+	message  string
+}
+
+// readReflog returns the reflog entries appended since the last call.
+func (w *OpWatcher) readReflog() []reflogEntry {
+	f, err := os.Open(w.reflogPath())
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil
+	}
+	if info.Size() < w.reflogSize {
+		// Rewritten (e.g. reflog expire); start over from the end.
+		w.reflogSize = info.Size()
+		return nil
+	}
+	if _, err := f.Seek(w.reflogSize, io.SeekStart); err != nil {
+		return nil
+	}
+	w.reflogSize = info.Size()
+
+	var entries []reflogEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if e, ok := parseReflogLine(scanner.Text()); ok {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// parseReflogLine parses "<old> <new> <name> <email> <time> <tz>\t<message>".
+func parseReflogLine(line string) (reflogEntry, bool) {
+	meta, message, ok := strings.Cut(line, "\t")
+	fields := strings.Fields(meta)
+	if !ok || len(fields) < 2 {
+		return reflogEntry{}, false
+	}
+	return reflogEntry{old: fields[0], new: fields[1], message: message}, true
+}
+
+// collapseRebase folds the many reflog entries of a rebase into its last
+// one, so a rebase is reported as a single operation.
+func collapseRebase(entries []reflogEntry) []reflogEntry {
+	var out []reflogEntry
+	rebaseStart := -1
+	for _, e := range entries {
+		if strings.HasPrefix(e.message, "rebase") {
+			if rebaseStart >= 0 {
+				out[len(out)-1].new, out[len(out)-1].message = e.new, e.message
+				continue
+			}
+			rebaseStart = len(out)
+		} else {
+			rebaseStart = -1
+		}
+		out = append(out, e)
+	}
+	return out
+}
+
+// describe turns a reflog message such as "commit: fix parser" or
+// "checkout: moving from main to feature" into a GitOp.
+func describe(e reflogEntry) types.GitOp {
+	action, detail, _ := strings.Cut(e.message, ": ")
+	kind := action
+	if i := strings.IndexAny(kind, " ("); i > 0 {
+		kind = kind[:i] // "commit (amend)" -> "commit", "merge feature" -> "merge"
+	}
+
+	summary := e.message
+	switch kind {
+	case "commit":
+		summary = action + " " + short(e.new) + ": " + detail
+	case "checkout":
+		if from, to, ok := strings.Cut(strings.TrimPrefix(detail, "moving from "), " to "); ok {
+			summary = "checkout " + from + " → " + to
+		}
+	case "reset":
+		summary = "reset to " + strings.TrimPrefix(detail, "moving to ")
+	case "rebase":
+		summary = "rebase onto " + short(e.new)
+		if strings.Contains(action, "abort") {
+			summary = "rebase aborted"
+		} else if strings.HasPrefix(detail, "returning to ") {
+			summary = "rebase finished on " + strings.TrimPrefix(detail, "returning to refs/heads/")
+		}
+	case "merge", "pull", "cherry-pick", "revert":
+		summary = action + ": " + detail + " (" + short(e.new) + ")"
+	}
+	return types.GitOp{Kind: kind, Summary: summary}
+}
+
+// matchesHead reports whether the index and tracked files match HEAD.
+func (r *Repo) matchesHead() bool {
+	return exec.Command("git", "-C", r.root, "diff", "--quiet", "HEAD").Run() == nil
+}
+
+func short(hash string) string {
+	if len(hash) > 7 {
+		return hash[:7]
+	}
+	return hash
+}
@@ -0,0 +1,92 @@
+package git
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/wgawan/agent-spy/internal/types"
+)
+
+func runGit(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@test.com",
+		"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@test.com")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %v: %v\n%s", args, err, out)
+	}
+}
+
+func TestOpWatcherDetectsOperations(t *testing.T) {
+	dir := initTestRepo(t)
+	r, _ := Open(dir)
+	w, err := r.WatchOps(make(chan types.FileEvent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	start := r.Branch()
+
+	os.WriteFile(filepath.Join(dir, "app.go"), []byte("package main\n"), 0644)
+	runGit(t, dir, "add", "app.go")
+	runGit(t, dir, "commit", "-m", "add app")
+	ops := w.check()
+	if len(ops) != 1 || ops[0].Kind != "commit" || !strings.HasSuffix(ops[0].Summary, ": add app") {
+		t.Fatalf("expected a commit, got %+v", ops)
+	}
+	if !strings.Contains(ops[0].Summary, short(r.Head())) {
+		t.Errorf("expected commit summary to name the new HEAD, got %q", ops[0].Summary)
+	}
+
+	runGit(t, dir, "checkout", "-q", "-b", "feature")
+	ops = w.check()
+	if len(ops) != 1 || ops[0].Summary != "checkout "+start+" → feature" || ops[0].Branch != "feature" {
+		t.Fatalf("expected a checkout, got %+v", ops)
+	}
+
+	runGit(t, dir, "reset", "-q", "--hard", "HEAD~1")
+	ops = w.check()
+	if len(ops) != 1 || ops[0].Summary != "reset --hard to HEAD~1" {
+		t.Fatalf("expected a hard reset, got %+v", ops)
+	}
+
+	if ops := w.check(); len(ops) != 0 {
+		t.Errorf("expected nothing new, got %+v", ops)
+	}
+}
+
+func TestDescribeReflog(t *testing.T) {
+	tests := []struct {
+		message string
+		kind    string
+		summary string
+	}{
+		{"commit (amend): fix typo", "commit", "commit (amend) 1234567: fix typo"},
+		{"merge feature: Fast-forward", "merge", "merge feature: Fast-forward (1234567)"},
+		{"rebase (finish): returning to refs/heads/feature", "rebase", "rebase finished on feature"},
+		{"rebase (abort): updating HEAD", "rebase", "rebase aborted"},
+		{"branch: Created from HEAD", "branch", "branch: Created from HEAD"},
+	}
+	for _, tt := range tests {
+		op := describe(reflogEntry{new: "1234567890abcdef", message: tt.message})
+		if op.Kind != tt.kind || op.Summary != tt.summary {
+			t.Errorf("describe(%q) = %+v, want %s %q", tt.message, op, tt.kind, tt.summary)
+		}
+	}
+}
+
+func TestCollapseRebase(t *testing.T) {
+	entries := []reflogEntry{
+		{new: "a", message: "commit: one"},
+		{new: "b", message: "rebase (start): checkout main"},
+		{new: "c", message: "rebase (pick): two"},
+		{new: "d", message: "rebase (finish): returning to refs/heads/feature"},
+	}
+	got := collapseRebase(entries)
+	if len(got) != 2 || got[1].new != "d" || !strings.Contains(got[1].message, "finish") {
+		t.Errorf("unexpected collapse: %+v", got)
+	}
+}
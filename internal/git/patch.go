@@ -0,0 +1,194 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// fileChange is the net change to one path over the session. For renames
+// oldPath and newPath differ.
+type fileChange struct {
+	oldPath string
+	newPath string
+	old     base
+	new     base
+}
+
+// SessionPatch returns a patch, suitable for `git apply`, of the net change
+// to every file seen this session: from its content before the first event
+// to its latest snapshot. Creates, deletes and renames (a delete and a create
+// with identical content) are included. If include is non-nil, only changes
+// touching a path it accepts are exported.
+//
+// Paths in the patch are relative to the worktree root, so it applies from
+// there even when a subdirectory is watched. Files inside submodules are
+// left out; git apply can't patch them from the superproject. So are files
+// over MaxDiffSize, whose content isn't kept.
+func (r *Repo) SessionPatch(include func(relPath string) bool) (string, error) {
+	changes := r.sessionChanges()
+
+	var out strings.Builder
+	for _, c := range changes {
+		if include != nil && !include(c.oldPath) && !include(c.newPath) {
+			continue
+		}
+		if c.old.partial || c.new.partial {
+			continue
+		}
+		if owner, _ := r.owner(c.oldPath); owner != r {
+			continue
+		}
+		if owner, _ := r.owner(c.newPath); owner != r {
+			continue
+		}
+		c.oldPath, c.newPath = r.repoPath(c.oldPath), r.repoPath(c.newPath)
+		section, err := formatFileChange(c)
+		if err != nil {
+			return "", err
+		}
+		out.WriteString(section)
+	}
+	return out.String(), nil
+}
+
+func (r *Repo) sessionChanges() []fileChange {
+	r.mu.Lock()
+	var changes []fileChange
+	for path, b := range r.bases {
+		cur := r.snapshots[path]
+		if b.same(cur) {
+			continue
+		}
+		changes = append(changes, fileChange{
+			oldPath: path,
+			newPath: path,
+			old:     b,
+			new:     cur,
+		})
+	}
+	r.mu.Unlock()
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].oldPath < changes[j].oldPath
+	})
+	return pairRenames(changes)
+}
+
+// pairRenames folds a deleted file and a created file with identical
+// (non-empty) content into a single rename.
+func pairRenames(changes []fileChange) []fileChange {
+	created := make(map[string]int) // content -> index of created file
+	for i, c := range changes {
+		if !c.old.exists && c.new.exists && c.new.content != "" {
+			if _, dup := created[c.new.content]; !dup {
+				created[c.new.content] = i
+			}
+		}
+	}
+
+	consumed := make(map[int]bool)
+	for i := range changes {
+		c := &changes[i]
+		if !c.old.exists || c.new.exists {
+			continue
+		}
+		if j, ok := created[c.old.content]; ok && !consumed[j] {
+			consumed[j] = true
+			c.newPath, c.new = changes[j].newPath, changes[j].new
+		}
+	}
+
+	var out []fileChange
+	for i, c := range changes {
+		if !consumed[i] {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// formatFileChange renders one file's section of the patch. The hunks come
+// from `git diff --no-index`; the headers are rewritten to the repo paths.
+func formatFileChange(c fileChange) (string, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "diff --git a/%s b/%s\n", c.oldPath, c.newPath)
+	if c.oldPath != c.newPath {
+		// Renames are only paired on identical content.
+		fmt.Fprintf(&b, "similarity index 100%%\nrename from %s\nrename to %s\n", c.oldPath, c.newPath)
+		return b.String(), nil
+	}
+
+	extended, body, err := rawDiff(c.old, c.new)
+	if err != nil {
+		return "", err
+	}
+	for _, line := range extended {
+		b.WriteString(line)
+		b.WriteByte('\n')
+	}
+	if strings.HasPrefix(body, "@@") {
+		oldName, newName := "a/"+c.oldPath, "b/"+c.newPath
+		if !c.old.exists {
+			oldName = "/dev/null"
+		}
+		if !c.new.exists {
+			newName = "/dev/null"
+		}
+		fmt.Fprintf(&b, "--- %s\n+++ %s\n", oldName, newName)
+	}
+	b.WriteString(body)
+	return b.String(), nil
+}
+
+// rawDiff runs git diff on the two versions and splits its output into the
+// extended header lines worth keeping (file modes, index) and the body
+// (text hunks or a binary patch).
+func rawDiff(old, new base) ([]string, string, error) {
+	tmpDir, err := os.MkdirTemp("", "agent-spy-patch-*")
+	if err != nil {
+		return nil, "", err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	oldFile, newFile := os.DevNull, os.DevNull
+	if old.exists {
+		oldFile = filepath.Join(tmpDir, "old")
+		if err := os.WriteFile(oldFile, []byte(old.content), 0644); err != nil {
+			return nil, "", err
+		}
+	}
+	if new.exists {
+		newFile = filepath.Join(tmpDir, "new")
+		if err := os.WriteFile(newFile, []byte(new.content), 0644); err != nil {
+			return nil, "", err
+		}
+	}
+
+	cmd := exec.Command("git", "diff", "--no-index", "--binary", "--full-index", "--", oldFile, newFile)
+	out, err := cmd.Output()
+	if err != nil {
+		// Exit code 1 just means the files differ.
+		if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 1 {
+			return nil, "", fmt.Errorf("git diff: %w", err)
+		}
+	}
+
+	lines := strings.SplitAfter(string(out), "\n")
+	var extended []string
+	for i, line := range lines {
+		trimmed := strings.TrimSuffix(line, "\n")
+		switch {
+		case strings.HasPrefix(trimmed, "@@"), strings.HasPrefix(trimmed, "GIT binary patch"):
+			return extended, strings.Join(lines[i:], ""), nil
+		case strings.HasPrefix(trimmed, "index "),
+			strings.HasPrefix(trimmed, "new file mode "),
+			strings.HasPrefix(trimmed, "deleted file mode "):
+			extended = append(extended, trimmed)
+		}
+	}
+	return extended, "", nil
+}
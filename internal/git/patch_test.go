@@ -0,0 +1,96 @@
+package git
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSessionPatchApplies(t *testing.T) {
+	dir := initTestRepo(t)
+	os.WriteFile(filepath.Join(dir, "old.txt"), []byte("moved content\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "gone.txt"), []byte("bye\n"), 0644)
+	for _, args := range [][]string{{"add", "."}, {"commit", "-m", "more"}} {
+		cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+		cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@test.com",
+			"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@test.com")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	clone := filepath.Join(t.TempDir(), "clone")
+	if out, err := exec.Command("git", "clone", "-q", dir, clone).CombinedOutput(); err != nil {
+		t.Fatalf("clone: %v\n%s", err, out)
+	}
+
+	r, _ := Open(dir)
+	write := func(name, content string) {
+		os.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+		r.Change(name)
+	}
+	remove := func(name string) {
+		os.Remove(filepath.Join(dir, name))
+		r.Change(name)
+	}
+
+	write("README.md", "# Test\n\nFirst edit\n")
+	write("README.md", "# Test\n\nSecond edit\n")
+	write("new.go", "package main\n")
+	write("tmp.txt", "scratch\n") // created and deleted: no net change
+	remove("tmp.txt")
+	remove("gone.txt")
+	remove("old.txt")
+	write("renamed.txt", "moved content\n")
+
+	patch, err := r.SessionPatch(nil)
+	if err != nil {
+		t.Fatalf("SessionPatch: %v", err)
+	}
+	if strings.Contains(patch, "tmp.txt") {
+		t.Error("file created and deleted within the session should not appear")
+	}
+	if !strings.Contains(patch, "rename from old.txt\nrename to renamed.txt\n") {
+		t.Errorf("expected rename in patch:\n%s", patch)
+	}
+
+	patchFile := filepath.Join(t.TempDir(), "session.patch")
+	os.WriteFile(patchFile, []byte(patch), 0644)
+	if out, err := exec.Command("git", "-C", clone, "apply", patchFile).CombinedOutput(); err != nil {
+		t.Fatalf("git apply: %v\n%s\npatch:\n%s", err, out, patch)
+	}
+
+	for name, want := range map[string]string{
+		"README.md":   "# Test\n\nSecond edit\n",
+		"new.go":      "package main\n",
+		"renamed.txt": "moved content\n",
+	} {
+		got, err := os.ReadFile(filepath.Join(clone, name))
+		if err != nil || string(got) != want {
+			t.Errorf("%s after apply = %q (%v), want %q", name, got, err, want)
+		}
+	}
+	for _, name := range []string{"gone.txt", "old.txt"} {
+		if _, err := os.Stat(filepath.Join(clone, name)); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be deleted after apply", name)
+		}
+	}
+}
+
+func TestSessionPatchFiltered(t *testing.T) {
+	dir := initTestRepo(t)
+	r, _ := Open(dir)
+	os.WriteFile(filepath.Join(dir, "a.go"), []byte("package a\n"), 0644)
+	r.Change("a.go")
+	os.WriteFile(filepath.Join(dir, "b.go"), []byte("package b\n"), 0644)
+	r.Change("b.go")
+
+	patch, err := r.SessionPatch(func(p string) bool { return p == "b.go" })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(patch, "a.go") || !strings.Contains(patch, "b/b.go") {
+		t.Errorf("expected only b.go in filtered patch:\n%s", patch)
+	}
+}
@@ -0,0 +1,165 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/wgawan/agent-spy/internal/types"
+)
+
+// FileStatus is a file's state relative to the index and HEAD, as the two
+// status letters of `git status --porcelain`. The zero value means the file
+// matches HEAD.
+type FileStatus struct {
+	Index    byte // staged change: 'M', 'A', 'D', 'R', ... or ' '
+	Worktree byte // unstaged change, or ' '
+}
+
+// Untracked is the status of a file git doesn't know about.
+var Untracked = FileStatus{Index: '?', Worktree: '?'}
+
+// Code returns the two-letter porcelain code, or "  " for a committed file.
+func (s FileStatus) Code() string {
+	if s == (FileStatus{}) {
+		return "  "
+	}
+	return string([]byte{s.Index, s.Worktree})
+}
+
+func (s FileStatus) String() string {
+	staged := s.Index != ' ' && s.Index != 0
+	unstaged := s.Worktree != ' ' && s.Worktree != 0
+	switch {
+	case s == Untracked:
+		return "untracked"
+	case staged && unstaged:
+		return "staged, with unstaged changes"
+	case staged:
+		return "staged"
+	case unstaged:
+		return "modified, not staged"
+	default:
+		return "committed"
+	}
+}
+
+// Status returns the status of every file under the watched directory that
+// differs from HEAD. Files not in the map match HEAD. Files inside
+// submodules seen this session are reported against the submodule's HEAD.
+func (r *Repo) Status() (map[string]FileStatus, error) {
+	if r.repo == nil {
+		return nil, fmt.Errorf("not a git repository")
+	}
+	status, err := r.status(".")
+	if err != nil {
+		return nil, err
+	}
+	for dir, sub := range r.nestedRepos() {
+		subStatus, err := sub.Status()
+		if err != nil {
+			continue
+		}
+		for path, s := range subStatus {
+			status[filepath.Join(dir, path)] = s
+		}
+	}
+	return status, nil
+}
+
+// status runs git status on pathspecs relative to the watched directory and
+// returns the results keyed the same way.
+func (r *Repo) status(paths ...string) (map[string]FileStatus, error) {
+	args := append([]string{"-C", r.path, "status", "--porcelain=v1", "-z", "--untracked-files=all", "--"}, paths...)
+	out, err := exec.Command("git", args...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("git status: %w", err)
+	}
+	// Porcelain paths are relative to the worktree root.
+	status := make(map[string]FileStatus)
+	for path, s := range parseStatus(out) {
+		if rel, ok := r.watchPath(path); ok {
+			status[rel] = s
+		}
+	}
+	return status, nil
+}
+
+// parseStatus parses `git status --porcelain=v1 -z` output: "XY path\0",
+// with the original path following renames and copies as an extra field.
+func parseStatus(out []byte) map[string]FileStatus {
+	status := make(map[string]FileStatus)
+	fields := bytes.Split(out, []byte{0})
+	for i := 0; i < len(fields); i++ {
+		f := fields[i]
+		if len(f) < 4 {
+			continue
+		}
+		s := FileStatus{Index: f[0], Worktree: f[1]}
+		status[string(f[3:])] = s
+		if s.Index == 'R' || s.Index == 'C' {
+			i++ // skip the source path
+		}
+	}
+	return status
+}
+
+// DiffBase selects what a file's working tree content is compared against.
+type DiffBase int
+
+const (
+	BaseIndex DiffBase = iota // unstaged changes
+	BaseHead                  // everything not yet committed
+)
+
+func (b DiffBase) String() string {
+	if b == BaseHead {
+		return "working tree vs HEAD"
+	}
+	return "working tree vs index"
+}
+
+// DiffAgainst diffs the working tree copy of relPath against the index or
+// HEAD. Untracked files are shown as entirely added.
+func (r *Repo) DiffAgainst(relPath string, against DiffBase) (types.DiffResult, error) {
+	if r.repo == nil {
+		return types.DiffResult{Available: false, Error: "not a git repository"}, nil
+	}
+	if owner, rel := r.owner(relPath); owner != r {
+		return owner.DiffAgainst(rel, against)
+	}
+	args := []string{"-C", r.path, "diff", "--no-color"}
+	if against == BaseHead {
+		args = append(args, "HEAD")
+	}
+	args = append(args, "--", relPath)
+	out, err := exec.Command("git", args...).Output()
+	if err != nil {
+		return types.DiffResult{Available: false, Error: err.Error()}, nil
+	}
+	if len(out) > 0 {
+		return parseDiffOutput(string(out)), nil
+	}
+
+	status, err := r.status(relPath)
+	if err == nil && status[relPath] == Untracked {
+		// git diff ignores untracked files
+		current, err := load(filepath.Join(r.path, relPath))
+		if err != nil {
+			return types.DiffResult{Available: false, Error: "file not readable"}, nil
+		}
+		if current.bin != nil {
+			return binaryDiff(base{}, current), nil
+		}
+		return r.diffStrings("", current.content, relPath)
+	}
+	return types.DiffResult{Available: false, Error: "no changes against " + baseName(against)}, nil
+}
+
+func baseName(b DiffBase) string {
+	if b == BaseHead {
+		return "HEAD"
+	}
+	return "the index"
+}
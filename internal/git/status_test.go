@@ -0,0 +1,79 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStatus(t *testing.T) {
+	dir := initTestRepo(t)
+	r, _ := Open(dir)
+
+	os.WriteFile(filepath.Join(dir, "new.txt"), []byte("new\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "staged.txt"), []byte("s\n"), 0644)
+	runGit(t, dir, "add", "staged.txt")
+	os.WriteFile(filepath.Join(dir, "README.md"), []byte("# Test\nmore\n"), 0644)
+
+	status, err := r.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]string{
+		"new.txt":    "untracked",
+		"staged.txt": "staged",
+		"README.md":  "modified, not staged",
+	}
+	for path, want := range tests {
+		if got := status[path].String(); got != want {
+			t.Errorf("%s: got %q, want %q", path, got, want)
+		}
+	}
+
+	runGit(t, dir, "add", "README.md")
+	os.WriteFile(filepath.Join(dir, "README.md"), []byte("# Test\nmore\nagain\n"), 0644)
+	status, _ = r.Status()
+	if got := status["README.md"]; got.Code() != "MM" || got.String() != "staged, with unstaged changes" {
+		t.Errorf("README.md: got %q (%s)", got.Code(), got)
+	}
+	if got := status["missing.txt"].String(); got != "committed" {
+		t.Errorf("expected unlisted file to be committed, got %q", got)
+	}
+}
+
+func TestParseStatusRename(t *testing.T) {
+	status := parseStatus([]byte("R  new.go\x00old.go\x00?? x.txt\x00"))
+	if len(status) != 2 || status["new.go"].Index != 'R' || status["x.txt"] != Untracked {
+		t.Errorf("unexpected status %+v", status)
+	}
+}
+
+func TestDiffAgainst(t *testing.T) {
+	dir := initTestRepo(t)
+	r, _ := Open(dir)
+	readme := filepath.Join(dir, "README.md")
+
+	os.WriteFile(readme, []byte("# Test\nstaged\n"), 0644)
+	runGit(t, dir, "add", "README.md")
+	os.WriteFile(readme, []byte("# Test\nstaged\nunstaged\n"), 0644)
+
+	vsIndex, _ := r.DiffAgainst("README.md", BaseIndex)
+	if !vsIndex.Available || vsIndex.Stats.Added != 1 {
+		t.Errorf("expected one unstaged line, got %+v", vsIndex)
+	}
+	vsHead, _ := r.DiffAgainst("README.md", BaseHead)
+	if !vsHead.Available || vsHead.Stats.Added != 2 {
+		t.Errorf("expected two uncommitted lines, got %+v", vsHead)
+	}
+
+	os.WriteFile(filepath.Join(dir, "new.txt"), []byte("a\nb\n"), 0644)
+	untracked, _ := r.DiffAgainst("new.txt", BaseHead)
+	if !untracked.Available || untracked.Stats.Added != 2 {
+		t.Errorf("expected untracked file shown as added, got %+v", untracked)
+	}
+
+	runGit(t, dir, "add", "README.md")
+	if clean, _ := r.DiffAgainst("README.md", BaseIndex); clean.Available {
+		t.Errorf("expected no unstaged changes, got %+v", clean)
+	}
+}
@@ -1,6 +1,7 @@
 package logger
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"time"
@@ -8,22 +9,163 @@ import (
 	"github.com/wgawan/agent-spy/internal/types"
 )
 
+type Format int
+
+const (
+	FormatText Format = iota
+	FormatJSONL
+)
+
+func ParseFormat(s string) (Format, error) {
+	switch s {
+	case "", "text":
+		return FormatText, nil
+	case "jsonl":
+		return FormatJSONL, nil
+	default:
+		return FormatText, fmt.Errorf("unknown log format %q (want text or jsonl)", s)
+	}
+}
+
+// Entry types written in the "type" field of JSON Lines records.
+const (
+	EntrySession = "session"
+	EntryEvent   = "event"
+)
+
 type Logger struct {
-	w io.Writer
+	w            io.Writer
+	format       Format
+	includePatch bool
 }
 
+// SessionEntry is the first JSON Lines record written for a session.
+type SessionEntry struct {
+	Type      string            `json:"type"` // "session"
+	Time      time.Time         `json:"time"`
+	WatchPath string            `json:"watch_path"`
+	GitBranch string            `json:"git_branch,omitempty"`
+	GitHead   string            `json:"git_head,omitempty"`
+	Roots     map[string]string `json:"roots,omitempty"` // label → path, when several are watched
+	Version   string            `json:"version"`
+	Flags     map[string]string `json:"flags,omitempty"`
+}
+
+// EventEntry is the JSON Lines record written for each event.
+type EventEntry struct {
+	Type       string            `json:"type"` // "event"
+	ID         int               `json:"id"`
+	Root       string            `json:"root,omitempty"`
+	Path       string            `json:"path"`
+	Op         types.Operation   `json:"op"`
+	Timestamp  time.Time         `json:"timestamp"`
+	SubEvents  []SubEventEntry   `json:"sub_events,omitempty"`
+	Stats      *types.DiffStats  `json:"stats,omitempty"`
+	BeforeHash string            `json:"before_hash,omitempty"`
+	AfterHash  string            `json:"after_hash,omitempty"`
+	Patch      string            `json:"patch,omitempty"`
+	Git        *types.GitOp      `json:"git,omitempty"`
+	CausedBy   string            `json:"caused_by,omitempty"`
+	Reconciled bool              `json:"reconciled,omitempty"`
+	IsDir      bool              `json:"is_dir,omitempty"`
+	Dir        string            `json:"dir,omitempty"`
+	NoOp       bool              `json:"no_op,omitempty"`
+	Meta       *types.MetaChange `json:"meta,omitempty"`
+	ChangeSet  int               `json:"change_set,omitempty"`
+	Paused     bool              `json:"paused,omitempty"`
+}
+
+type SubEventEntry struct {
+	Op        types.Operation `json:"op"`
+	Timestamp time.Time       `json:"timestamp"`
+}
+
+// New returns a logger writing one text line per event.
 func New(w io.Writer) *Logger {
 	return &Logger{w: w}
 }
 
+// NewJSONL returns a logger writing one JSON object per line. With
+// includePatch, each event carries its full unified diff.
+func NewJSONL(w io.Writer, includePatch bool) *Logger {
+	return &Logger{w: w, format: FormatJSONL, includePatch: includePatch}
+}
+
+// LogSession writes the session header. Text logs have no header.
+func (l *Logger) LogSession(s SessionEntry) {
+	if l.format != FormatJSONL {
+		return
+	}
+	s.Type = EntrySession
+	l.writeJSON(s)
+}
+
+// LogRecord writes an enriched event in the logger's format.
+func (l *Logger) LogRecord(rec types.Record) {
+	var stats *types.DiffStats
+	if rec.Diff.Available {
+		stats = &rec.Diff.Stats
+	}
+	if l.format != FormatJSONL {
+		l.LogEvent(rec.Event, stats)
+		return
+	}
+
+	entry := EventEntry{
+		Type:       EntryEvent,
+		ID:         rec.ID,
+		Root:       rec.Event.Root,
+		Path:       rec.Event.Path,
+		Op:         rec.Event.Op,
+		Timestamp:  rec.Event.Timestamp,
+		Stats:      stats,
+		BeforeHash: rec.BeforeHash,
+		AfterHash:  rec.AfterHash,
+		Git:        rec.Event.Git,
+		CausedBy:   rec.CausedBy,
+		Reconciled: rec.Event.Reconciled,
+		IsDir:      rec.Event.IsDir,
+		Dir:        rec.Event.Dir,
+		NoOp:       rec.NoOp,
+		Meta:       rec.Event.Meta,
+		ChangeSet:  rec.ChangeSet,
+		Paused:     rec.Event.Paused,
+	}
+	for _, sub := range rec.Event.SubEvents {
+		entry.SubEvents = append(entry.SubEvents, SubEventEntry{Op: sub.Op, Timestamp: sub.Timestamp})
+	}
+	if l.includePatch {
+		entry.Patch = rec.Diff.Unified(rec.Event.Path)
+	}
+	l.writeJSON(entry)
+}
+
 func (l *Logger) LogEvent(ev types.FileEvent, stats *types.DiffStats) {
+	path := ev.Path
+	if ev.Git != nil {
+		path = ev.Git.Summary
+		if ev.Root != "" {
+			path = ev.Root + ": " + path
+		}
+	}
 	line := fmt.Sprintf("%s %s %s",
 		ev.Timestamp.Format(time.RFC3339),
 		ev.Op.String(),
-		ev.Path,
+		path,
 	)
 	if stats != nil {
 		line += fmt.Sprintf(" +%d -%d", stats.Added, stats.Deleted)
 	}
+	if ev.Meta != nil {
+		line += " (" + ev.Meta.Summary() + ")"
+	}
 	fmt.Fprintln(l.w, line)
 }
+
+func (l *Logger) writeJSON(v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	l.w.Write(append(data, '\n'))
+}
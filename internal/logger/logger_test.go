@@ -1,6 +1,8 @@
 package logger
 
 import (
+	"bytes"
+	"encoding/json"
 	"os"
 	"strings"
 	"testing"
@@ -62,3 +64,99 @@ func TestLoggerWithoutStats(t *testing.T) {
 		t.Errorf("got %q, want %q", line, expected)
 	}
 }
+
+func TestParseFormat(t *testing.T) {
+	if f, err := ParseFormat("jsonl"); err != nil || f != FormatJSONL {
+		t.Errorf("ParseFormat(jsonl) = %v, %v", f, err)
+	}
+	if f, err := ParseFormat(""); err != nil || f != FormatText {
+		t.Errorf("ParseFormat(\"\") = %v, %v", f, err)
+	}
+	if _, err := ParseFormat("xml"); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
+
+func TestJSONLWritesSessionAndEvents(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewJSONL(&buf, true)
+
+	l.LogSession(SessionEntry{
+		Time:      time.Date(2026, 2, 17, 14, 0, 0, 0, time.UTC),
+		WatchPath: "/work/app",
+		GitBranch: "main",
+		Version:   "0.1.0",
+		Flags:     map[string]string{"debounce": "500"},
+	})
+	ts := time.Date(2026, 2, 17, 14, 3, 2, 0, time.UTC)
+	l.LogRecord(types.Record{
+		ID: 7,
+		Event: types.FileEvent{
+			Path:      "src/app.go",
+			Op:        types.OpModify,
+			Timestamp: ts,
+			SubEvents: []types.FileEvent{
+				{Path: "src/app.go", Op: types.OpModify, Timestamp: ts.Add(-time.Second)},
+				{Path: "src/app.go", Op: types.OpModify, Timestamp: ts},
+			},
+		},
+		BeforeHash: "aaa",
+		AfterHash:  "bbb",
+		Diff: types.DiffResult{
+			Available: true,
+			Hunks: []types.DiffHunk{{
+				Header: "@@ -1 +1 @@",
+				Lines: []types.DiffLine{
+					{Content: "old", Type: types.DiffLineDelete},
+					{Content: "new", Type: types.DiffLineAdd},
+				},
+			}},
+			Stats: types.DiffStats{Added: 1, Deleted: 1},
+		},
+	})
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %d: %q", len(lines), buf.String())
+	}
+
+	var session SessionEntry
+	if err := json.Unmarshal([]byte(lines[0]), &session); err != nil {
+		t.Fatal(err)
+	}
+	if session.Type != EntrySession || session.WatchPath != "/work/app" || session.Flags["debounce"] != "500" {
+		t.Errorf("unexpected session header: %+v", session)
+	}
+
+	var ev EventEntry
+	if err := json.Unmarshal([]byte(lines[1]), &ev); err != nil {
+		t.Fatal(err)
+	}
+	if ev.Type != EntryEvent || ev.ID != 7 || ev.Op != types.OpModify || ev.Path != "src/app.go" {
+		t.Errorf("unexpected event: %+v", ev)
+	}
+	if len(ev.SubEvents) != 2 || !ev.SubEvents[0].Timestamp.Equal(ts.Add(-time.Second)) {
+		t.Errorf("unexpected sub-events: %+v", ev.SubEvents)
+	}
+	if ev.Stats == nil || ev.Stats.Added != 1 || ev.BeforeHash != "aaa" || ev.AfterHash != "bbb" {
+		t.Errorf("unexpected stats or hashes: %+v", ev)
+	}
+	if !strings.Contains(ev.Patch, "-old\n+new\n") {
+		t.Errorf("expected patch in entry, got %q", ev.Patch)
+	}
+}
+
+func TestTextFormatIgnoresSessionHeader(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(&buf)
+	l.LogSession(SessionEntry{WatchPath: "/work/app"})
+	l.LogRecord(types.Record{Event: types.FileEvent{
+		Path:      "a.go",
+		Op:        types.OpDelete,
+		Timestamp: time.Date(2026, 2, 17, 14, 3, 1, 0, time.UTC),
+	}})
+
+	if got := strings.TrimSpace(buf.String()); got != "2026-02-17T14:03:01Z DELETE a.go" {
+		t.Errorf("unexpected text log %q", got)
+	}
+}
@@ -0,0 +1,146 @@
+package report
+
+import (
+	"html/template"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/wgawan/agent-spy/internal/logger"
+)
+
+// patchLine is one line of a recorded patch with its highlight class.
+type patchLine struct {
+	Class string
+	Text  string
+}
+
+type htmlData struct {
+	Header    *logger.SessionEntry
+	Totals    Totals
+	Duration  string
+	Events    []logger.EventEntry
+	Files     []FileSummary
+	Hotspots  []FileSummary
+	Generated time.Time
+}
+
+var funcs = template.FuncMap{
+	"anchor": anchor,
+	"clock": func(t time.Time) string {
+		return t.Format("15:04:05")
+	},
+	"stamp": func(t time.Time) string {
+		return t.Format("2006-01-02 15:04:05 MST")
+	},
+	"patchLines": patchLines,
+}
+
+// WriteHTML renders a self-contained HTML report for s. All styles are
+// inline so the page works offline and can be attached to a PR.
+func WriteHTML(w io.Writer, s Session) error {
+	t := s.Totals()
+	data := htmlData{
+		Header:    s.Header,
+		Totals:    t,
+		Events:    s.Events,
+		Files:     s.Files(),
+		Hotspots:  s.Hotspots(10),
+		Generated: time.Now(),
+	}
+	if !t.Start.IsZero() && !t.End.IsZero() && t.End.After(t.Start) {
+		data.Duration = t.End.Sub(t.Start).Round(time.Second).String()
+	}
+	return reportTemplate.Execute(w, data)
+}
+
+func anchor(path string) string {
+	return "file-" + strings.NewReplacer("/", "-", ".", "-", " ", "-").Replace(path)
+}
+
+func patchLines(patch string) []patchLine {
+	var lines []patchLine
+	for _, line := range strings.Split(strings.TrimSuffix(patch, "\n"), "\n") {
+		class := "ctx"
+		switch {
+		case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+			class = "meta"
+		case strings.HasPrefix(line, "@@"):
+			class = "hunk"
+		case strings.HasPrefix(line, "+"):
+			class = "add"
+		case strings.HasPrefix(line, "-"):
+			class = "del"
+		}
+		lines = append(lines, patchLine{Class: class, Text: line})
+	}
+	return lines
+}
+
+var reportTemplate = template.Must(template.New("report").Funcs(funcs).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>agent-spy report{{with .Header}}: {{.WatchPath}}{{end}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em auto; max-width: 1100px; color: #24292f; padding: 0 1em; }
+h1 { font-size: 1.5em; } h2 { font-size: 1.2em; border-bottom: 1px solid #d0d7de; padding-bottom: .3em; margin-top: 2em; }
+table { border-collapse: collapse; width: 100%; font-size: .9em; }
+th, td { text-align: left; padding: .3em .6em; border-bottom: 1px solid #eaeef2; }
+th { background: #f6f8fa; }
+code, pre { font-family: ui-monospace, SFMono-Regular, Menlo, Consolas, monospace; font-size: .85em; }
+.meta-list { color: #57606a; } .meta-list code { color: #24292f; }
+.totals { display: flex; flex-wrap: wrap; gap: 1em; margin: 1em 0; }
+.totals div { background: #f6f8fa; border: 1px solid #d0d7de; border-radius: 6px; padding: .6em 1em; }
+.totals b { display: block; font-size: 1.4em; }
+.plus { color: #1a7f37; } .minus { color: #cf222e; }
+.op { font-family: ui-monospace, monospace; font-weight: bold; }
+details { border: 1px solid #d0d7de; border-radius: 6px; margin: .6em 0; }
+summary { cursor: pointer; padding: .5em .8em; background: #f6f8fa; }
+.event { padding: .4em .8em; border-top: 1px solid #eaeef2; }
+pre { margin: .4em 0; overflow-x: auto; background: #fff; }
+pre span { display: block; white-space: pre; }
+.add { background: #e6ffec; } .del { background: #ffebe9; } .hunk { background: #ddf4ff; color: #0550ae; } .meta { color: #57606a; }
+.muted { color: #57606a; font-style: italic; }
+</style>
+</head>
+<body>
+<h1>agent-spy session report</h1>
+<p class="meta-list">
+{{with .Header}}Watching <code>{{.WatchPath}}</code>{{if .GitBranch}} on <code>{{.GitBranch}}</code>{{end}}{{if .GitHead}} at <code>{{.GitHead}}</code>{{end}} &middot; agent-spy {{.Version}} &middot; {{end}}
+{{if not .Totals.Start.IsZero}}started {{stamp .Totals.Start}}{{end}}{{if .Duration}} &middot; lasted {{.Duration}}{{end}}
+</p>
+
+<div class="totals">
+<div><b>{{.Totals.Events}}</b>events</div>
+<div><b>{{.Totals.Files}}</b>files</div>
+<div><b class="plus">+{{.Totals.Added}}</b>lines added</div>
+<div><b class="minus">-{{.Totals.Deleted}}</b>lines deleted</div>
+<div><b>{{.Totals.Created}} / {{.Totals.Modified}} / {{.Totals.Removed}}</b>created / modified / deleted</div>
+{{if .Totals.GitOps}}<div><b>{{.Totals.GitOps}}</b>git operations</div>{{end}}
+</div>
+
+<h2>Hotspots</h2>
+{{if .Hotspots}}<table>
+<tr><th>File</th><th>Events</th><th>Lines</th></tr>
+{{range .Hotspots}}<tr><td><a href="#{{anchor .Path}}"><code>{{.Path}}</code></a></td><td>{{len .Events}}</td><td><span class="plus">+{{.Added}}</span> <span class="minus">-{{.Deleted}}</span></td></tr>
+{{end}}</table>{{else}}<p class="muted">No events recorded.</p>{{end}}
+
+<h2>Timeline</h2>
+{{if .Events}}<table>
+<tr><th>Time</th><th>Set</th><th>Op</th><th>File</th><th>Lines</th></tr>
+{{range .Events}}<tr><td>{{clock .Timestamp}}</td><td class="muted">{{with .ChangeSet}}#{{.}}{{end}}</td><td class="op">{{.Op}}</td><td>{{if .Git}}<b>{{.Git.Summary}}</b>{{else}}<a href="#{{anchor .Path}}"><code>{{.Path}}</code></a>{{if gt (len .SubEvents) 1}} <span class="muted">(x{{len .SubEvents}})</span>{{end}}{{with .CausedBy}} <span class="muted">via {{.}}</span>{{end}}{{if .Reconciled}} <span class="muted">(reconciled)</span>{{end}}{{if .NoOp}} <span class="muted">(no-op)</span>{{end}}{{if .Paused}} <span class="muted">(changed while paused)</span>{{end}}{{with .Meta}} <span class="muted">({{.Summary}})</span>{{end}}{{end}}</td><td>{{with .Stats}}<span class="plus">+{{.Added}}</span> <span class="minus">-{{.Deleted}}</span>{{end}}</td></tr>
+{{end}}</table>{{else}}<p class="muted">No events recorded.</p>{{end}}
+
+<h2>Files</h2>
+{{range .Files}}<details id="{{anchor .Path}}">
+<summary><code>{{.Path}}</code> &middot; {{len .Events}} event(s) &middot; <span class="plus">+{{.Added}}</span> <span class="minus">-{{.Deleted}}</span></summary>
+{{range .Events}}<div class="event"><span class="op">{{.Op}}</span> {{clock .Timestamp}}
+{{if .Patch}}<pre>{{range patchLines .Patch}}<span class="{{.Class}}">{{.Text}}</span>{{end}}</pre>{{else}}<span class="muted">&mdash; no patch recorded (log with -log-patch to include diffs)</span>{{end}}
+</div>
+{{end}}</details>
+{{end}}
+<p class="muted">Generated {{stamp .Generated}} by agent-spy.</p>
+</body>
+</html>
+`))
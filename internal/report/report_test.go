@@ -0,0 +1,99 @@
+package report
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wgawan/agent-spy/internal/logger"
+	"github.com/wgawan/agent-spy/internal/types"
+)
+
+func sampleLog(t *testing.T) string {
+	t.Helper()
+	var buf bytes.Buffer
+	l := logger.NewJSONL(&buf, true)
+	start := time.Date(2026, 2, 17, 14, 0, 0, 0, time.UTC)
+
+	l.LogSession(logger.SessionEntry{Time: start.Add(-time.Hour), WatchPath: "/old"})
+	l.LogRecord(types.Record{ID: 1, Event: types.FileEvent{Path: "stale.go", Op: types.OpCreate, Timestamp: start.Add(-time.Hour)}})
+
+	l.LogSession(logger.SessionEntry{Time: start, WatchPath: "/work/app", GitBranch: "main", Version: "0.1.0"})
+	modify := func(id int, path string, at time.Duration, added, deleted int) {
+		l.LogRecord(types.Record{
+			ID:    id,
+			Event: types.FileEvent{Path: path, Op: types.OpModify, Timestamp: start.Add(at)},
+			Diff: types.DiffResult{
+				Available: true,
+				Hunks: []types.DiffHunk{{
+					Header: "@@ -1 +1 @@",
+					Lines: []types.DiffLine{
+						{Content: "<old>", Type: types.DiffLineDelete},
+						{Content: "<new>", Type: types.DiffLineAdd},
+					},
+				}},
+				Stats: types.DiffStats{Added: added, Deleted: deleted},
+			},
+		})
+	}
+	modify(1, "src/app.go", time.Minute, 1, 1)
+	modify(2, "src/app.go", 2*time.Minute, 3, 0)
+	modify(3, "README.md", 3*time.Minute, 1, 1)
+	l.LogRecord(types.Record{ID: 4, Event: types.FileEvent{Path: "old.txt", Op: types.OpDelete, Timestamp: start.Add(4 * time.Minute)}})
+	return buf.String()
+}
+
+func TestLoadSplitsSessions(t *testing.T) {
+	sessions, err := Load(strings.NewReader(sampleLog(t)))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(sessions) != 2 {
+		t.Fatalf("expected 2 sessions, got %d", len(sessions))
+	}
+	s := sessions[1]
+	if s.Header.WatchPath != "/work/app" || len(s.Events) != 4 {
+		t.Fatalf("unexpected session: %+v", s)
+	}
+
+	tot := s.Totals()
+	if tot.Events != 4 || tot.Files != 3 || tot.Added != 5 || tot.Deleted != 2 || tot.Modified != 3 || tot.Removed != 1 {
+		t.Errorf("unexpected totals: %+v", tot)
+	}
+	if hot := s.Hotspots(1); len(hot) != 1 || hot[0].Path != "src/app.go" {
+		t.Errorf("expected src/app.go as top hotspot, got %+v", hot)
+	}
+}
+
+func TestLoadRejectsTextLog(t *testing.T) {
+	if _, err := Load(strings.NewReader("2026-02-17T14:03:02Z MODIFY src/app.go +12 -3\n")); err == nil {
+		t.Error("expected error for a text log")
+	}
+}
+
+func TestWriteHTML(t *testing.T) {
+	sessions, _ := Load(strings.NewReader(sampleLog(t)))
+	var buf bytes.Buffer
+	if err := WriteHTML(&buf, sessions[1]); err != nil {
+		t.Fatalf("WriteHTML: %v", err)
+	}
+	html := buf.String()
+
+	for _, want := range []string{
+		"/work/app",
+		`<span class="add">&#43;&lt;new&gt;</span>`,
+		`<span class="del">-&lt;old&gt;</span>`,
+		`id="file-src-app-go"`,
+		"lasted 4m0s",
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("expected report to contain %q", want)
+		}
+	}
+	for _, banned := range []string{"http://", "https://", "<script src", "<link"} {
+		if strings.Contains(html, banned) {
+			t.Errorf("report must not reference external assets, found %q", banned)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package report
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/wgawan/agent-spy/internal/logger"
+	"github.com/wgawan/agent-spy/internal/types"
+)
+
+// Session is one recorded session from a JSON Lines log.
+type Session struct {
+	Header *logger.SessionEntry
+	Events []logger.EventEntry
+}
+
+// Load reads a JSON Lines session log (as written with -log-format jsonl).
+// Log files are appended to, so a file may hold several sessions; each
+// header record starts a new one.
+func Load(r io.Reader) ([]Session, error) {
+	var sessions []Session
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024) // patches can be large
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var kind struct {
+			Type string `json:"type"`
+		}
+		if err := json.Unmarshal([]byte(line), &kind); err != nil {
+			return nil, fmt.Errorf("line %d: not a JSON Lines session log: %v", lineNo, err)
+		}
+		switch kind.Type {
+		case logger.EntrySession:
+			var h logger.SessionEntry
+			if err := json.Unmarshal([]byte(line), &h); err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNo, err)
+			}
+			sessions = append(sessions, Session{Header: &h})
+		case logger.EntryEvent:
+			var ev logger.EventEntry
+			if err := json.Unmarshal([]byte(line), &ev); err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNo, err)
+			}
+			if len(sessions) == 0 {
+				sessions = append(sessions, Session{})
+			}
+			last := &sessions[len(sessions)-1]
+			last.Events = append(last.Events, ev)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// FileSummary aggregates every event recorded for one path.
+type FileSummary struct {
+	Path    string
+	Events  []logger.EventEntry
+	Added   int
+	Deleted int
+}
+
+// Totals are the session-wide counts shown at the top of a report.
+type Totals struct {
+	Events   int
+	Files    int
+	Added    int
+	Deleted  int
+	Created  int
+	Modified int
+	Removed  int
+	Renamed  int
+	GitOps   int
+	Start    time.Time
+	End      time.Time
+}
+
+func (s Session) Totals() Totals {
+	var t Totals
+	files := make(map[string]bool)
+	for _, ev := range s.Events {
+		if t.Start.IsZero() || ev.Timestamp.Before(t.Start) {
+			t.Start = ev.Timestamp
+		}
+		if ev.Timestamp.After(t.End) {
+			t.End = ev.Timestamp
+		}
+		if ev.NoOp {
+			continue // rewrote identical content
+		}
+		t.Events++
+		if ev.Op == types.OpGit {
+			t.GitOps++
+			continue
+		}
+		if ev.IsDir {
+			continue // its files have events of their own
+		}
+		files[ev.Path] = true
+		if ev.Stats != nil {
+			t.Added += ev.Stats.Added
+			t.Deleted += ev.Stats.Deleted
+		}
+		switch ev.Op {
+		case types.OpCreate:
+			t.Created++
+		case types.OpModify:
+			t.Modified++
+		case types.OpDelete:
+			t.Removed++
+		case types.OpRename:
+			t.Renamed++
+		}
+	}
+	if s.Header != nil && !s.Header.Time.IsZero() {
+		t.Start = s.Header.Time
+	}
+	t.Files = len(files)
+	return t
+}
+
+// Files groups file events by path, sorted by path.
+func (s Session) Files() []FileSummary {
+	byPath := make(map[string]*FileSummary)
+	var order []string
+	for _, ev := range s.Events {
+		if ev.Op == types.OpGit || ev.IsDir || ev.NoOp {
+			continue
+		}
+		f, ok := byPath[ev.Path]
+		if !ok {
+			f = &FileSummary{Path: ev.Path}
+			byPath[ev.Path] = f
+			order = append(order, ev.Path)
+		}
+		f.Events = append(f.Events, ev)
+		if ev.Stats != nil {
+			f.Added += ev.Stats.Added
+			f.Deleted += ev.Stats.Deleted
+		}
+	}
+	sort.Strings(order)
+	files := make([]FileSummary, 0, len(order))
+	for _, p := range order {
+		files = append(files, *byPath[p])
+	}
+	return files
+}
+
+// Hotspots returns up to n files with the most events, breaking ties by
+// lines changed.
+func (s Session) Hotspots(n int) []FileSummary {
+	files := s.Files()
+	sort.SliceStable(files, func(i, j int) bool {
+		if len(files[i].Events) != len(files[j].Events) {
+			return len(files[i].Events) > len(files[j].Events)
+		}
+		return files[i].Added+files[i].Deleted > files[j].Added+files[j].Deleted
+	})
+	if len(files) > n {
+		files = files[:n]
+	}
+	return files
+}
@@ -0,0 +1,337 @@
+package store
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/wgawan/agent-spy/internal/types"
+)
+
+// Store is the in-memory history of a session. Every event is recorded here
+// once and consumers (the TUI, the HTTP API) read from it, so everyone sees
+// the same IDs, diffs and totals.
+type Store struct {
+	mu        sync.RWMutex
+	records   []types.Record // oldest first, ordered by ID
+	nextID    int
+	totals    totals
+	startTime time.Time
+	alerts    []types.Alert
+	roots     map[string]*totals // by root label, when several are watched
+
+	setGap  time.Duration
+	setID   int       // current change set
+	setLast time.Time // latest event in it
+}
+
+// DefaultChangeSetGap is the quiet gap that ends a change set by default.
+const DefaultChangeSetGap = 2 * time.Second
+
+// totals are kept for the whole session and for each root. Writes that left
+// a file's content unchanged are counted apart.
+type totals struct {
+	events  int
+	noOps   int
+	files   map[string]int // path → real changes to it
+	added   int
+	deleted int
+}
+
+func newTotals() *totals {
+	return &totals{files: make(map[string]int)}
+}
+
+// count adds (sign 1) or removes (sign -1) rec from the totals.
+func (t *totals) count(rec types.Record, sign int) {
+	if rec.NoOp {
+		t.noOps += sign
+		return
+	}
+	t.events += sign
+	if rec.Event.IsFile() {
+		p := rec.Event.Path
+		t.files[p] += sign
+		if t.files[p] <= 0 {
+			delete(t.files, p)
+		}
+	}
+	if rec.Diff.Available {
+		t.added += sign * rec.Diff.Stats.Added
+		t.deleted += sign * rec.Diff.Stats.Deleted
+	}
+}
+
+// Stats holds the session totals shown in the stats bar. Events and Files
+// leave out writes that didn't change any content; NoOps counts those.
+type Stats struct {
+	Events    int       `json:"events"`
+	Files     int       `json:"files"`
+	Added     int       `json:"added"`
+	Deleted   int       `json:"deleted"`
+	NoOps     int       `json:"no_ops"`
+	StartTime time.Time `json:"start_time"`
+	// Roots breaks the totals down by watched root, sorted by label. It is
+	// empty when a single root is watched.
+	Roots []RootStats `json:"roots,omitempty"`
+}
+
+// RootStats holds one watched root's share of the session totals.
+type RootStats struct {
+	Root    string `json:"root"`
+	Events  int    `json:"events"`
+	Files   int    `json:"files"`
+	Added   int    `json:"added"`
+	Deleted int    `json:"deleted"`
+}
+
+func New() *Store {
+	return &Store{
+		nextID:    1,
+		totals:    *newTotals(),
+		startTime: time.Now(),
+		roots:     make(map[string]*totals),
+		setGap:    DefaultChangeSetGap,
+	}
+}
+
+// SetChangeSetGap sets how long a quiet gap between events must be to start
+// a new change set. 0 turns change sets off.
+func (s *Store) SetChangeSetGap(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.setGap = d
+}
+
+// Add appends rec, assigning it the next ID, and returns the stored copy.
+func (s *Store) Add(rec types.Record) types.Record {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec.ID = s.nextID
+	s.nextID++
+	if s.setGap > 0 {
+		ts := rec.Event.Timestamp
+		if s.setID == 0 || ts.Sub(s.setLast) >= s.setGap {
+			s.setID++
+		}
+		if ts.After(s.setLast) {
+			s.setLast = ts
+		}
+		rec.ChangeSet = s.setID
+	}
+	s.records = append(s.records, rec)
+	s.count(rec, 1)
+	return rec
+}
+
+// Update replaces the stored record with the same ID, typically once its
+// diff is ready. It reports false if the record is no longer stored.
+func (s *Store) Update(rec types.Record) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i, ok := s.index(rec.ID)
+	if !ok {
+		return false
+	}
+	s.count(s.records[i], -1)
+	s.count(rec, 1)
+	s.records[i] = rec
+	return true
+}
+
+func (s *Store) count(rec types.Record, sign int) {
+	s.totals.count(rec, sign)
+	if root := rec.Event.Root; root != "" {
+		rt, ok := s.roots[root]
+		if !ok {
+			rt = newTotals()
+			s.roots[root] = rt
+		}
+		rt.count(rec, sign)
+	}
+}
+
+// Get returns the record with the given ID.
+func (s *Store) Get(id int) (types.Record, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if i, ok := s.index(id); ok {
+		return s.records[i], true
+	}
+	return types.Record{}, false
+}
+
+// index finds a record by ID; records are kept sorted by ID.
+func (s *Store) index(id int) (int, bool) {
+	i := sort.Search(len(s.records), func(i int) bool {
+		return s.records[i].ID >= id
+	})
+	return i, i < len(s.records) && s.records[i].ID == id
+}
+
+// Page returns up to limit records starting at offset, oldest first.
+func (s *Store) Page(offset, limit int) []types.Record {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if offset < 0 || offset >= len(s.records) {
+		return nil
+	}
+	end := offset + limit
+	if limit < 0 || end > len(s.records) {
+		end = len(s.records)
+	}
+	page := make([]types.Record, end-offset)
+	copy(page, s.records[offset:end])
+	return page
+}
+
+func (s *Store) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.records)
+}
+
+func (s *Store) Stats() Stats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.stats(&s.totals, s.roots)
+}
+
+// StatsSince returns the totals of the records after ID id, for a view that
+// was cleared once it had shown id.
+func (s *Store) StatsSince(id int) Stats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if id <= 0 {
+		return s.stats(&s.totals, s.roots)
+	}
+	t, roots := newTotals(), make(map[string]*totals)
+	i, _ := s.index(id + 1)
+	for _, rec := range s.records[i:] {
+		t.count(rec, 1)
+		if root := rec.Event.Root; root != "" {
+			if roots[root] == nil {
+				roots[root] = newTotals()
+			}
+			roots[root].count(rec, 1)
+		}
+	}
+	return s.stats(t, roots)
+}
+
+func (s *Store) stats(t *totals, roots map[string]*totals) Stats {
+	st := Stats{
+		Events:    t.events,
+		Files:     len(t.files),
+		Added:     t.added,
+		Deleted:   t.deleted,
+		NoOps:     t.noOps,
+		StartTime: s.startTime,
+	}
+	for name, rt := range roots {
+		st.Roots = append(st.Roots, RootStats{
+			Root:    name,
+			Events:  rt.events,
+			Files:   len(rt.files),
+			Added:   rt.added,
+			Deleted: rt.deleted,
+		})
+	}
+	sort.Slice(st.Roots, func(i, j int) bool { return st.Roots[i].Root < st.Roots[j].Root })
+	return st
+}
+
+// LastID returns the ID of the latest record, or 0 if there is none.
+func (s *Store) LastID() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.nextID - 1
+}
+
+// ChangeSet is a burst of events with no quiet gap between them. Its totals
+// leave out no-op writes, like Stats.
+type ChangeSet struct {
+	ID      int       `json:"id"`
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+	Events  []int     `json:"events"` // record IDs, oldest first
+	Files   []string  `json:"files"`  // sorted
+	Added   int       `json:"added"`
+	Deleted int       `json:"deleted"`
+}
+
+// ChangeSets returns the change sets of the stored records, oldest first.
+func (s *Store) ChangeSets() []ChangeSet {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return groupChangeSets(s.records)
+}
+
+// groupChangeSets collects records, ordered by ID, into their change sets.
+func groupChangeSets(records []types.Record) []ChangeSet {
+	var sets []ChangeSet
+	files := make(map[string]bool)
+	for _, rec := range records {
+		if rec.ChangeSet == 0 || rec.NoOp {
+			continue
+		}
+		if len(sets) == 0 || sets[len(sets)-1].ID != rec.ChangeSet {
+			if len(sets) > 0 {
+				sets[len(sets)-1].Files = sortedKeys(files)
+				files = make(map[string]bool)
+			}
+			sets = append(sets, ChangeSet{ID: rec.ChangeSet})
+		}
+		cs := &sets[len(sets)-1]
+		cs.Events = append(cs.Events, rec.ID)
+		if ts := rec.Event.Timestamp; !ts.IsZero() {
+			if cs.Start.IsZero() || ts.Before(cs.Start) {
+				cs.Start = ts
+			}
+			if ts.After(cs.End) {
+				cs.End = ts
+			}
+		}
+		if rec.Event.IsFile() {
+			files[rec.Event.Path] = true
+		}
+		if rec.Diff.Available {
+			cs.Added += rec.Diff.Stats.Added
+			cs.Deleted += rec.Diff.Stats.Deleted
+		}
+	}
+	if len(sets) > 0 {
+		sets[len(sets)-1].Files = sortedKeys(files)
+	}
+	return sets
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// AddAlert records a notable condition for the session.
+func (s *Store) AddAlert(a types.Alert) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if a.Time.IsZero() {
+		a.Time = time.Now()
+	}
+	s.alerts = append(s.alerts, a)
+}
+
+// Alerts returns the alerts raised so far, oldest first.
+func (s *Store) Alerts() []types.Alert {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]types.Alert(nil), s.alerts...)
+}
@@ -0,0 +1,191 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/wgawan/agent-spy/internal/types"
+)
+
+func addEvent(s *Store, path string, added, deleted int) types.Record {
+	return s.Add(types.Record{
+		Event: types.FileEvent{Path: path, Op: types.OpModify, Timestamp: time.Now()},
+		Diff:  types.DiffResult{Available: true, Stats: types.DiffStats{Added: added, Deleted: deleted}},
+	})
+}
+
+func TestStoreAssignsIDs(t *testing.T) {
+	s := New()
+	a := addEvent(s, "a.go", 1, 0)
+	b := addEvent(s, "b.go", 2, 1)
+	if a.ID != 1 || b.ID != 2 {
+		t.Errorf("expected IDs 1 and 2, got %d and %d", a.ID, b.ID)
+	}
+
+	got, ok := s.Get(2)
+	if !ok || got.Event.Path != "b.go" {
+		t.Errorf("Get(2) = %+v, %v", got, ok)
+	}
+	if _, ok := s.Get(3); ok {
+		t.Error("expected Get(3) to miss")
+	}
+}
+
+func TestStoreStats(t *testing.T) {
+	s := New()
+	addEvent(s, "a.go", 3, 1)
+	addEvent(s, "a.go", 2, 2)
+	addEvent(s, "b.go", 1, 0)
+
+	st := s.Stats()
+	if st.Events != 3 || st.Files != 2 || st.Added != 6 || st.Deleted != 3 {
+		t.Errorf("unexpected stats: %+v", st)
+	}
+
+	last := s.LastID()
+	if st := s.StatsSince(last); st.Events != 0 || st.Files != 0 || st.Added != 0 || st.Deleted != 0 {
+		t.Errorf("expected empty stats since the last record, got %+v", st)
+	}
+	addEvent(s, "a.go", 1, 0)
+	if st := s.StatsSince(last); st.Events != 1 || st.Files != 1 || st.Added != 1 {
+		t.Errorf("unexpected stats since %d: %+v", last, st)
+	}
+	if st := s.Stats(); st.Events != 4 || st.Files != 2 || st.Added != 7 {
+		t.Errorf("expected session stats to be kept, got %+v", st)
+	}
+}
+
+func TestStorePage(t *testing.T) {
+	s := New()
+	for i := 0; i < 5; i++ {
+		addEvent(s, "a.go", 1, 0)
+	}
+
+	page := s.Page(1, 2)
+	if len(page) != 2 || page[0].ID != 2 || page[1].ID != 3 {
+		t.Errorf("unexpected page: %+v", page)
+	}
+	if page := s.Page(4, 10); len(page) != 1 {
+		t.Errorf("expected 1 record at the tail, got %d", len(page))
+	}
+	if page := s.Page(10, 10); page != nil {
+		t.Errorf("expected nil page past the end, got %+v", page)
+	}
+}
+
+func TestStoreUpdate(t *testing.T) {
+	s := New()
+	rec := s.Add(types.Record{
+		Event:   types.FileEvent{Path: "a.go", Op: types.OpModify},
+		Pending: true,
+	})
+	if st := s.Stats(); st.Files != 1 || st.Added != 0 {
+		t.Errorf("unexpected stats for pending record: %+v", st)
+	}
+
+	rec.Pending = false
+	rec.Diff = types.DiffResult{Available: true, Stats: types.DiffStats{Added: 4, Deleted: 1}}
+	if !s.Update(rec) {
+		t.Fatal("expected Update to find the record")
+	}
+	if st := s.Stats(); st.Added != 4 || st.Deleted != 1 {
+		t.Errorf("expected totals to include the ready diff, got %+v", st)
+	}
+	if got, _ := s.Get(rec.ID); got.Pending {
+		t.Error("expected stored record to no longer be pending")
+	}
+
+	if s.Update(types.Record{ID: 99}) {
+		t.Error("expected Update to miss an unknown ID")
+	}
+}
+
+func TestStoreRootStats(t *testing.T) {
+	s := New()
+	for _, ev := range []struct {
+		root, path string
+		added      int
+	}{
+		{"svc", "svc/main.go", 3},
+		{"svc", "svc/main.go", 1},
+		{"lib", "lib/util.go", 2},
+	} {
+		s.Add(types.Record{
+			Event: types.FileEvent{Root: ev.root, Path: ev.path, Op: types.OpModify},
+			Diff:  types.DiffResult{Available: true, Stats: types.DiffStats{Added: ev.added}},
+		})
+	}
+
+	roots := s.Stats().Roots
+	if len(roots) != 2 {
+		t.Fatalf("expected 2 roots, got %+v", roots)
+	}
+	if roots[0] != (RootStats{Root: "lib", Events: 1, Files: 1, Added: 2}) {
+		t.Errorf("lib: %+v", roots[0])
+	}
+	if roots[1] != (RootStats{Root: "svc", Events: 2, Files: 1, Added: 4}) {
+		t.Errorf("svc: %+v", roots[1])
+	}
+
+	single := New()
+	addEvent(single, "a.go", 1, 0)
+	if got := single.Stats().Roots; got != nil {
+		t.Errorf("expected no root breakdown for a single root, got %+v", got)
+	}
+}
+
+func TestStoreCountsNoOpsApart(t *testing.T) {
+	s := New()
+	addEvent(s, "a.go", 2, 0)
+	rec := s.Add(types.Record{Event: types.FileEvent{Path: "b.go", Op: types.OpModify}, Pending: true})
+	if st := s.Stats(); st.Events != 2 || st.Files != 2 {
+		t.Fatalf("expected the pending write to count, got %+v", st)
+	}
+
+	// Its diff shows the content didn't change
+	rec.Pending, rec.NoOp = false, true
+	s.Update(rec)
+	st := s.Stats()
+	if st.Events != 1 || st.Files != 1 || st.NoOps != 1 {
+		t.Errorf("expected the no-op write counted apart, got %+v", st)
+	}
+}
+
+func TestStoreGroupsChangeSets(t *testing.T) {
+	s := New()
+	s.SetChangeSetGap(time.Second)
+	start := time.Now()
+	add := func(path string, after time.Duration, added int) types.Record {
+		return s.Add(types.Record{
+			Event: types.FileEvent{Path: path, Op: types.OpModify, Timestamp: start.Add(after)},
+			Diff:  types.DiffResult{Available: true, Stats: types.DiffStats{Added: added}},
+		})
+	}
+	add("a.go", 0, 1)
+	add("b.go", 500*time.Millisecond, 2)
+	add("a.go", 1200*time.Millisecond, 3) // within a second of the last event
+	last := add("c.go", 5*time.Second, 4)
+
+	if last.ChangeSet != 2 {
+		t.Errorf("expected the event after the gap in set 2, got %d", last.ChangeSet)
+	}
+	sets := s.ChangeSets()
+	if len(sets) != 2 {
+		t.Fatalf("expected 2 change sets, got %+v", sets)
+	}
+	first := sets[0]
+	if first.ID != 1 || len(first.Events) != 3 || first.Added != 6 {
+		t.Errorf("unexpected first set %+v", first)
+	}
+	if len(first.Files) != 2 || first.Files[0] != "a.go" || first.Files[1] != "b.go" {
+		t.Errorf("expected files a.go and b.go, got %v", first.Files)
+	}
+	if first.End.Sub(first.Start) != 1200*time.Millisecond {
+		t.Errorf("unexpected span %v–%v", first.Start, first.End)
+	}
+
+	s.SetChangeSetGap(0)
+	if rec := add("d.go", 10*time.Second, 1); rec.ChangeSet != 0 {
+		t.Errorf("expected no change set with grouping off, got %d", rec.ChangeSet)
+	}
+}
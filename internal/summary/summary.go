@@ -0,0 +1,249 @@
+// Package summary renders a session as Markdown for pull request descriptions.
+package summary
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/wgawan/agent-spy/internal/store"
+	"github.com/wgawan/agent-spy/internal/types"
+)
+
+// LargestChanges is how many files the "Largest changes" table lists.
+const LargestChanges = 5
+
+type Info struct {
+	WatchPath string
+	GitBranch string
+	End       time.Time // defaults to now
+}
+
+// fileChange is the net effect of a session on one path.
+type fileChange struct {
+	path    string
+	kind    string // "created", "modified" or "deleted"
+	renamed bool
+	events  int
+	added   int
+	deleted int
+}
+
+// Write renders the session held in st as Markdown.
+func Write(w io.Writer, st *store.Store, info Info) error {
+	if info.End.IsZero() {
+		info.End = time.Now()
+	}
+	stats := st.Stats()
+	records := st.Page(0, -1)
+	files := netChanges(records)
+
+	var b strings.Builder
+	b.WriteString("## agent-spy session summary\n\n")
+	if info.WatchPath != "" {
+		fmt.Fprintf(&b, "Watched `%s`", info.WatchPath)
+		if info.GitBranch != "" {
+			fmt.Fprintf(&b, " on branch `%s`", info.GitBranch)
+		}
+		fmt.Fprintf(&b, " for %s.\n\n", formatDuration(info.End.Sub(stats.StartTime)))
+	}
+	fmt.Fprintf(&b, "**%d** events across **%d** files: **+%d / -%d** lines.\n",
+		stats.Events, stats.Files, stats.Added, stats.Deleted)
+
+	for _, kind := range []string{"created", "modified", "deleted"} {
+		writeGroup(&b, kind, files)
+	}
+	writeLargest(&b, files)
+	writeChangeSets(&b, st.ChangeSets(), files)
+	writeGitOps(&b, records)
+	writeAlerts(&b, st.Alerts())
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// netChanges folds each path's events into a single change. Files created
+// and deleted again within the session are left out.
+func netChanges(records []types.Record) []fileChange {
+	byPath := make(map[string]*fileChange)
+	first := make(map[string]types.Operation)
+	var order []string
+	for _, rec := range records {
+		if !rec.Event.IsFile() || rec.NoOp {
+			continue
+		}
+		p := rec.Event.Path
+		f, ok := byPath[p]
+		if !ok {
+			f = &fileChange{path: p}
+			byPath[p] = f
+			first[p] = rec.Event.Op
+			order = append(order, p)
+		}
+		f.events++
+		if rec.Diff.Available {
+			f.added += rec.Diff.Stats.Added
+			f.deleted += rec.Diff.Stats.Deleted
+		}
+		gone := rec.Event.Op == types.OpDelete || rec.Event.Op == types.OpRename
+		f.renamed = rec.Event.Op == types.OpRename
+		switch {
+		case gone:
+			f.kind = "deleted"
+		case first[p] == types.OpCreate:
+			f.kind = "created"
+		default:
+			f.kind = "modified"
+		}
+		if gone && first[p] == types.OpCreate {
+			f.kind = ""
+		}
+	}
+
+	sort.Strings(order)
+	var files []fileChange
+	for _, p := range order {
+		if byPath[p].kind != "" {
+			files = append(files, *byPath[p])
+		}
+	}
+	return files
+}
+
+func writeGroup(b *strings.Builder, kind string, files []fileChange) {
+	byDir := make(map[string][]fileChange)
+	var dirs []string
+	count := 0
+	for _, f := range files {
+		if f.kind != kind {
+			continue
+		}
+		dir := path.Dir(f.path)
+		if _, ok := byDir[dir]; !ok {
+			dirs = append(dirs, dir)
+		}
+		byDir[dir] = append(byDir[dir], f)
+		count++
+	}
+	if count == 0 {
+		return
+	}
+
+	fmt.Fprintf(b, "\n### %s%s (%d)\n", strings.ToUpper(kind[:1]), kind[1:], count)
+	sort.Strings(dirs)
+	for _, dir := range dirs {
+		label := dir + "/"
+		if dir == "." {
+			label = "(root)"
+		}
+		fmt.Fprintf(b, "\n**%s**\n", label)
+		for _, f := range byDir[dir] {
+			fmt.Fprintf(b, "- `%s` %s", f.path, lineCounts(f))
+			if f.renamed {
+				b.WriteString(" (moved away)")
+			}
+			b.WriteByte('\n')
+		}
+	}
+}
+
+func writeLargest(b *strings.Builder, files []fileChange) {
+	largest := append([]fileChange(nil), files...)
+	sort.SliceStable(largest, func(i, j int) bool {
+		return largest[i].added+largest[i].deleted > largest[j].added+largest[j].deleted
+	})
+	n := 0
+	for n < len(largest) && n < LargestChanges && largest[n].added+largest[n].deleted > 0 {
+		n++
+	}
+	if n == 0 {
+		return
+	}
+	b.WriteString("\n### Largest changes\n\n| File | Lines | Events |\n|---|---|---|\n")
+	for _, f := range largest[:n] {
+		fmt.Fprintf(b, "| `%s` | %s | %d |\n", f.path, lineCounts(f), f.events)
+	}
+}
+
+// writeChangeSets lists the bursts of activity that touched several of the
+// files the session changed.
+func writeChangeSets(b *strings.Builder, sets []store.ChangeSet, files []fileChange) {
+	changed := make(map[string]bool, len(files))
+	for _, f := range files {
+		changed[f.path] = true
+	}
+	var lines []string
+	for _, cs := range sets {
+		var paths []string
+		for _, p := range cs.Files {
+			if changed[p] {
+				paths = append(paths, p)
+			}
+		}
+		if len(paths) < 2 {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("- **#%d** %s–%s: %d files, +%d / -%d: `%s`\n",
+			cs.ID, cs.Start.Format("15:04:05"), cs.End.Format("15:04:05"),
+			len(paths), cs.Added, cs.Deleted, strings.Join(paths, "`, `")))
+	}
+	if len(lines) == 0 {
+		return
+	}
+	fmt.Fprintf(b, "\n### Change sets (%d)\n\n", len(lines))
+	for _, line := range lines {
+		b.WriteString(line)
+	}
+}
+
+func writeGitOps(b *strings.Builder, records []types.Record) {
+	var ops []types.Record
+	for _, rec := range records {
+		if rec.Event.Git != nil {
+			ops = append(ops, rec)
+		}
+	}
+	if len(ops) == 0 {
+		return
+	}
+	fmt.Fprintf(b, "\n### Git operations (%d)\n\n", len(ops))
+	for _, rec := range ops {
+		fmt.Fprintf(b, "- %s %s\n", rec.Event.Timestamp.Format("15:04:05"), rec.Event.Git.Summary)
+	}
+}
+
+func writeAlerts(b *strings.Builder, alerts []types.Alert) {
+	if len(alerts) == 0 {
+		return
+	}
+	fmt.Fprintf(b, "\n### Alerts (%d)\n\n", len(alerts))
+	for _, a := range alerts {
+		fmt.Fprintf(b, "- %s", a.Time.Format("15:04:05"))
+		if a.Path != "" {
+			fmt.Fprintf(b, " `%s`", a.Path)
+		}
+		fmt.Fprintf(b, ": %s\n", a.Message)
+	}
+}
+
+func lineCounts(f fileChange) string {
+	return fmt.Sprintf("+%d / -%d", f.added, f.deleted)
+}
+
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Second)
+	h := int(d.Hours())
+	m := int(d.Minutes()) % 60
+	s := int(d.Seconds()) % 60
+	switch {
+	case h > 0:
+		return fmt.Sprintf("%dh %dm", h, m)
+	case m > 0:
+		return fmt.Sprintf("%dm %ds", m, s)
+	default:
+		return fmt.Sprintf("%ds", s)
+	}
+}
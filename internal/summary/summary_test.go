@@ -0,0 +1,68 @@
+package summary
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wgawan/agent-spy/internal/store"
+	"github.com/wgawan/agent-spy/internal/types"
+)
+
+func add(st *store.Store, path string, op types.Operation, added, deleted int) {
+	st.Add(types.Record{
+		Event: types.FileEvent{Path: path, Op: op, Timestamp: time.Now()},
+		Diff:  types.DiffResult{Available: true, Stats: types.DiffStats{Added: added, Deleted: deleted}},
+	})
+}
+
+func TestWriteGroupsByDirectory(t *testing.T) {
+	st := store.New()
+	add(st, "src/new.go", types.OpCreate, 40, 0)
+	add(st, "src/app.go", types.OpModify, 5, 2)
+	add(st, "src/app.go", types.OpModify, 1, 1)
+	add(st, "README.md", types.OpModify, 3, 0)
+	add(st, "old.txt", types.OpDelete, 0, 9)
+	add(st, "scratch.tmp", types.OpCreate, 1, 0)
+	add(st, "scratch.tmp", types.OpDelete, 0, 1)
+	st.Add(types.Record{Event: types.FileEvent{Path: ".git", Op: types.OpGit,
+		Git: &types.GitOp{Kind: "commit", Summary: "commit abc1234: add parser"}}})
+	st.AddAlert(types.Alert{Path: "src", Message: "events were lost; rescanned"})
+
+	var b strings.Builder
+	if err := Write(&b, st, Info{WatchPath: "~/app", GitBranch: "main"}); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+
+	for _, want := range []string{
+		"Watched `~/app` on branch `main`",
+		"**8** events across **5** files: **+50 / -13** lines.",
+		"### Created (1)\n\n**src/**\n- `src/new.go` +40 / -0\n",
+		"### Modified (2)\n\n**(root)**\n- `README.md` +3 / -0\n\n**src/**\n- `src/app.go` +6 / -3\n",
+		"### Deleted (1)\n\n**(root)**\n- `old.txt` +0 / -9\n",
+		"| `src/new.go` | +40 / -0 | 1 |\n| `old.txt` | +0 / -9 | 1 |",
+		"### Change sets (1)",
+		"4 files, +50 / -13: `README.md`, `old.txt`, `src/app.go`, `src/new.go`\n",
+		"### Git operations (1)",
+		"commit abc1234: add parser",
+		"### Alerts (1)",
+		"`src`: events were lost; rescanned",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("summary missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "scratch.tmp") {
+		t.Errorf("expected short-lived file to be left out:\n%s", out)
+	}
+}
+
+func TestWriteEmptySession(t *testing.T) {
+	var b strings.Builder
+	Write(&b, store.New(), Info{})
+	out := b.String()
+	if !strings.Contains(out, "**0** events") || strings.Contains(out, "###") {
+		t.Errorf("unexpected summary for empty session:\n%s", out)
+	}
+}
@@ -0,0 +1,194 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/wgawan/agent-spy/internal/git"
+)
+
+// Checkpoints is the checkpoint history shown in the checkpoint view.
+type Checkpoints interface {
+	List() []git.Checkpoint
+	Diff(from, to int) (string, error)
+	Restore(n int) error
+}
+
+// checkpointDiffMsg carries the diff between two checkpoints.
+type checkpointDiffMsg struct {
+	from, to int
+	diff     string
+	err      error
+}
+
+// checkpointDiffRange is the pair of checkpoints the diff pane compares: the
+// marked base, or else the one before the selection.
+func (m Model) checkpointDiffRange() (int, int) {
+	from := m.cpSelected - 1
+	if m.cpBase >= 0 {
+		from = m.cpBase
+	}
+	return from, m.cpSelected
+}
+
+func (m Model) loadCheckpointDiff() tea.Cmd {
+	from, to := m.checkpointDiffRange()
+	cps := m.checkpoints
+	return func() tea.Msg {
+		diff, err := cps.Diff(from, to)
+		return checkpointDiffMsg{from: from, to: to, diff: diff, err: err}
+	}
+}
+
+func (m Model) handleCheckpointKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	key := msg.String()
+	if key != "r" {
+		m.confirmRestore = false
+	}
+	n := len(m.checkpoints.List())
+
+	switch key {
+	case "q", "ctrl+c":
+		m.quitting = true
+		return m, tea.Quit
+	case "C", "esc":
+		if key == "esc" && m.fullscreen {
+			m.fullscreen = false
+			return m, nil
+		}
+		m.checkpointMode = false
+		m.detailScroll = 0
+		return m, nil
+	case "up", "k":
+		// Newest is at the top
+		if m.cpSelected < n {
+			m.cpSelected++
+			m.detailScroll = 0
+			return m, m.loadCheckpointDiff()
+		}
+	case "down", "j":
+		if m.cpSelected > 1 {
+			m.cpSelected--
+			m.detailScroll = 0
+			return m, m.loadCheckpointDiff()
+		}
+	case " ":
+		if m.cpBase == m.cpSelected {
+			m.cpBase = -1
+		} else {
+			m.cpBase = m.cpSelected
+		}
+		m.detailScroll = 0
+		return m, m.loadCheckpointDiff()
+	case "r":
+		if m.cpSelected < 1 {
+			return m, nil
+		}
+		if !m.confirmRestore {
+			m.confirmRestore = true
+			m.status = fmt.Sprintf("restore working tree to checkpoint #%d? press r again to confirm", m.cpSelected)
+			return m, nil
+		}
+		m.confirmRestore = false
+		target, cps := m.cpSelected, m.checkpoints
+		return m, func() tea.Msg {
+			if err := cps.Restore(target); err != nil {
+				return statusMsg("restore failed: " + err.Error())
+			}
+			return statusMsg(fmt.Sprintf("restored checkpoint #%d (previous state saved as a new checkpoint)", target))
+		}
+	case "F":
+		m.fullscreen = !m.fullscreen
+	case "ctrl+d":
+		m.detailScroll++
+	case "ctrl+u":
+		if m.detailScroll > 0 {
+			m.detailScroll--
+		}
+	}
+	return m, nil
+}
+
+func (m Model) renderCheckpointList(width, height int) string {
+	cps := m.checkpoints.List()
+	if len(cps) == 0 {
+		content := normalStyle.Render("  No checkpoints yet")
+		return borderStyle.Width(width - 2).Height(height - 2).Render(content)
+	}
+
+	lines := []string{headerStyle.Render(" Checkpoints")}
+	for i := len(cps) - 1; i >= 0 && len(lines) < height-2; i-- {
+		cp := cps[i]
+		line := fmt.Sprintf(" #%d %s %s %d files", cp.N, cp.Time.Format("15:04:05"), cp.Hash[:7], cp.Files)
+		if cp.N == m.cpBase {
+			line += " (base)"
+		}
+		if len(line) > width-6 {
+			line = line[:width-7] + "…"
+		}
+		if cp.N == m.cpSelected {
+			lines = append(lines, selectedStyle.Width(width-4).Render("▶ "+line))
+		} else {
+			lines = append(lines, normalStyle.Width(width-4).Render("  "+line))
+		}
+	}
+	content := strings.Join(lines, "\n")
+	return borderStyle.Width(width - 2).Height(height - 2).Render(content)
+}
+
+func (m Model) renderCheckpointDiff(width, height int) string {
+	if m.cpSelected < 1 {
+		content := normalStyle.Render("  Select a checkpoint to view its changes")
+		return borderStyle.Width(width - 2).Height(height - 2).Render(content)
+	}
+
+	from, to := m.checkpointDiffRange()
+	title := fmt.Sprintf(" #%d → #%d", from, to)
+	if from == 0 {
+		title = fmt.Sprintf(" session start → #%d", to)
+	}
+	lines := []string{headerStyle.Render(title)}
+	switch {
+	case m.cpDiffFrom != from || m.cpDiffTo != to:
+		lines = append(lines, helpStyle.Render("  computing diff…"))
+	case m.cpDiffErr != nil:
+		lines = append(lines, normalStyle.Render("  "+m.cpDiffErr.Error()))
+	case m.cpDiff == "":
+		lines = append(lines, normalStyle.Render("  No changes"))
+	default:
+		for _, line := range strings.Split(strings.TrimSuffix(m.cpDiff, "\n"), "\n") {
+			lines = append(lines, renderPatchLine(line, width-4))
+		}
+	}
+
+	if m.detailScroll > 0 && m.detailScroll < len(lines) {
+		lines = lines[m.detailScroll:]
+	}
+	if maxLines := height - 3; len(lines) > maxLines {
+		lines = lines[:maxLines]
+	}
+	content := strings.Join(lines, "\n")
+	return borderStyle.Width(width - 2).Height(height - 2).Render(content)
+}
+
+// renderPatchLine colours one line of raw unified diff text.
+func renderPatchLine(line string, maxWidth int) string {
+	if len(line) > maxWidth-1 {
+		line = line[:maxWidth-2] + "…"
+	}
+	switch {
+	case strings.HasPrefix(line, "diff --git"):
+		return headerStyle.Render(" " + line)
+	case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+		return helpStyle.Render(" " + line)
+	case strings.HasPrefix(line, "@@"):
+		return diffHunkStyle.Render(" " + line)
+	case strings.HasPrefix(line, "+"):
+		return diffAddStyle.Render(" " + line)
+	case strings.HasPrefix(line, "-"):
+		return diffDelStyle.Render(" " + line)
+	default:
+		return diffContextStyle.Render(" " + line)
+	}
+}
@@ -8,43 +8,233 @@ import (
 )
 
 func (m Model) renderDetail(width, height int) string {
-	filtered := m.filteredEvents()
-	if len(filtered) == 0 || m.selected >= len(filtered) {
+	row, ok := m.selectedRow()
+	if !ok {
 		content := normalStyle.Render("  Select an event to view details")
 		return borderStyle.Width(width - 2).Height(height - 2).Render(content)
 	}
+	if row.isHeader() {
+		return m.renderChangeSet(row, width, height)
+	}
 
 	var lines []string
 
 	// Show selected file info
-	ev := filtered[m.selected]
-	header := headerStyle.Render(fmt.Sprintf(" %s %s %s", ev.Op.Symbol(), ev.Path, ev.Timestamp.Format("15:04:05")))
+	rec := row.rec
+	ev, diff := rec.Event, rec.Diff
+	title := ev.Path
+	if ev.Git != nil {
+		title = ev.Git.Summary
+	}
+	header := headerStyle.Render(fmt.Sprintf(" %s %s %s", ev.Op.Symbol(), title, ev.Timestamp.Format("15:04:05")))
 	lines = append(lines, header)
+	if rec.CausedBy != "" {
+		lines = append(lines, helpStyle.Render("  caused by git: "+rec.CausedBy))
+	}
+	if rec.NoOp {
+		lines = append(lines, helpStyle.Render("  content unchanged: only the file's metadata was written"))
+	}
+	if ev.Reconciled {
+		lines = append(lines, helpStyle.Render("  missed by the watcher, found by a rescan"))
+	}
+	if ev.Meta != nil {
+		lines = append(lines, metaLines(*ev.Meta)...)
+	}
+	if m.fileStatus != nil && ev.IsFile() {
+		lines = append(lines, helpStyle.Render("  git: "+m.fileStatus[ev.Path].String()))
+	}
+	if m.diffMode != diffEdit && ev.IsFile() {
+		lines = append(lines, helpStyle.Render("  showing "+m.diffMode.base().String()))
+		if m.altLoaded != (altDiffKey{path: ev.Path, mode: m.diffMode}) {
+			lines = append(lines, helpStyle.Render("  computing diff…"))
+			return m.finishDetail(lines, width, height)
+		}
+		diff = m.altDiff
+	}
 
-	if !m.currentDiff.Available {
+	if ev.IsDir {
+		lines = append(lines, m.dirContents(rec)...)
+	} else if ev.Git != nil {
+		lines = append(lines, normalStyle.Render("  operation: "+ev.Git.Kind))
+		if ev.Git.Branch != "" {
+			lines = append(lines, normalStyle.Render("  branch:    "+ev.Git.Branch))
+		}
+		if ev.Git.Head != "" {
+			lines = append(lines, normalStyle.Render("  HEAD:      "+ev.Git.Head))
+		}
+	} else if ev.Op == types.OpMeta && m.diffMode == diffEdit {
+		// Nothing but metadata changed
+	} else if rec.Pending && m.diffMode == diffEdit {
+		lines = append(lines, helpStyle.Render("  computing diff…"))
+	} else if diff.Binary != nil {
+		lines = append(lines, binaryLines(*diff.Binary)...)
+	} else if !diff.Available {
 		msg := "  No diff available"
-		if m.currentDiff.Error != "" {
-			msg = fmt.Sprintf("  %s", m.currentDiff.Error)
+		if diff.Error != "" {
+			msg = fmt.Sprintf("  %s", diff.Error)
 		}
 		lines = append(lines, normalStyle.Render(msg))
 	} else {
-		for _, hunk := range m.currentDiff.Hunks {
-			lines = append(lines, diffHunkStyle.Render(hunk.Header))
-			for _, line := range hunk.Lines {
-				rendered := renderDiffLine(line, width-4)
-				lines = append(lines, rendered)
-			}
-		}
+		lines = append(lines, hunkLines(diff, width)...)
 
 		// Stats summary
-		stats := fmt.Sprintf("  %s %s",
-			addedStyle.Render(fmt.Sprintf("+%d", m.currentDiff.Stats.Added)),
-			deletedStyle.Render(fmt.Sprintf("-%d", m.currentDiff.Stats.Deleted)),
-		)
-		lines = append(lines, "", stats)
+		lines = append(lines, "", statLine(diff.Stats.Added, diff.Stats.Deleted))
+	}
+
+	return m.finishDetail(lines, width, height)
+}
+
+// renderChangeSet shows a change set's combined stats and its events'
+// diffs, oldest first.
+func (m Model) renderChangeSet(row listRow, width, height int) string {
+	files, added, deleted := setStats(row.members)
+	newest, oldest := row.members[0], row.members[len(row.members)-1]
+	lines := []string{
+		headerStyle.Render(fmt.Sprintf(" change set #%d %s–%s", row.set,
+			oldest.Event.Timestamp.Format("15:04:05"), newest.Event.Timestamp.Format("15:04:05"))),
+		normalStyle.Render(fmt.Sprintf("  %d events, %d files", len(row.members), files)),
+		statLine(added, deleted),
+	}
+	for i := len(row.members) - 1; i >= 0; i-- {
+		rec := row.members[i]
+		title := rec.Event.Path
+		if rec.Event.Git != nil {
+			title = rec.Event.Git.Summary
+		}
+		lines = append(lines, "", headerStyle.Render(fmt.Sprintf(" %s %s %s", rec.Event.Op.Symbol(), title, rec.Event.Timestamp.Format("15:04:05"))))
+		switch {
+		case rec.Event.Meta != nil && rec.Event.Op == types.OpMeta:
+			lines = append(lines, metaLines(*rec.Event.Meta)...)
+		case rec.Event.Git != nil, rec.Event.IsDir:
+		case rec.Pending:
+			lines = append(lines, helpStyle.Render("  computing diff…"))
+		case rec.Diff.Binary != nil:
+			lines = append(lines, binaryLines(*rec.Diff.Binary)...)
+		case rec.Diff.Available:
+			lines = append(lines, hunkLines(rec.Diff, width)...)
+		case rec.Diff.Error != "":
+			lines = append(lines, normalStyle.Render("  "+rec.Diff.Error))
+		}
+	}
+	return m.finishDetail(lines, width, height)
+}
+
+func hunkLines(diff types.DiffResult, width int) []string {
+	var lines []string
+	for _, hunk := range diff.Hunks {
+		lines = append(lines, diffHunkStyle.Render(hunk.Header))
+		for _, line := range hunk.Lines {
+			lines = append(lines, renderDiffLine(line, width-4))
+		}
+	}
+	return lines
+}
+
+func statLine(added, deleted int) string {
+	return fmt.Sprintf("  %s %s",
+		addedStyle.Render(fmt.Sprintf("+%d", added)),
+		deletedStyle.Render(fmt.Sprintf("-%d", deleted)),
+	)
+}
+
+// dirContents lists the files of a removed or moved directory, which were
+// reported as separate events just before it.
+func (m Model) dirContents(rec types.Record) []string {
+	verb := "removed"
+	if rec.Event.Op == types.OpRename {
+		verb = "moved away"
+	}
+	var files []string
+	for _, r := range m.records {
+		if r.Event.Dir == rec.Event.Path && r.ID < rec.ID {
+			files = append(files, "  "+r.Event.Path)
+		}
+	}
+	lines := []string{normalStyle.Render(fmt.Sprintf("  directory %s, with %d files:", verb, len(files)))}
+	for i := len(files) - 1; i >= 0; i-- { // oldest first
+		lines = append(lines, normalStyle.Render(files[i]))
+	}
+	return lines
+}
+
+// metaLines shows a metadata change as old → new per changed field.
+func metaLines(meta types.MetaChange) []string {
+	var lines []string
+	for _, f := range []struct{ name, old, new string }{
+		{"mode:  ", meta.OldMode, meta.NewMode},
+		{"owner: ", meta.OldOwner, meta.NewOwner},
+		{"target:", meta.OldTarget, meta.NewTarget},
+	} {
+		if f.old != "" || f.new != "" {
+			lines = append(lines, normalStyle.Render(fmt.Sprintf("  %s %s → %s", f.name, f.old, f.new)))
+		}
+	}
+	return lines
+}
+
+// binaryLines summarizes a change to a binary file, or one too large to
+// diff, in place of hunks.
+func binaryLines(b types.BinaryDiff) []string {
+	title := map[string]string{
+		types.BinaryImage:   "image changed",
+		types.BinaryArchive: "archive changed",
+		types.BinaryLarge:   "file too large to diff",
+	}[b.Kind]
+	if title == "" {
+		title = "binary file changed"
+	}
+	side := func(exists bool, s string) string {
+		if !exists {
+			return "—"
+		}
+		return s
 	}
+	had, has := b.OldHash != "", b.NewHash != ""
+	lines := []string{
+		normalStyle.Render("  " + title),
+		normalStyle.Render(fmt.Sprintf("  size:   %s → %s", side(had, formatSize(b.OldSize)), side(has, formatSize(b.NewSize)))),
+		normalStyle.Render(fmt.Sprintf("  sha256: %s → %s", side(had, shortHash(b.OldHash)), side(has, shortHash(b.NewHash)))),
+	}
+	if b.OldDims != "" || b.NewDims != "" {
+		lines = append(lines, normalStyle.Render(fmt.Sprintf("  pixels: %s → %s", side(b.OldDims != "", b.OldDims), side(b.NewDims != "", b.NewDims))))
+	}
+	if n := len(b.Added) + len(b.Removed) + len(b.Changed); n > 0 {
+		lines = append(lines, "", normalStyle.Render(fmt.Sprintf("  %d entries changed:", n)))
+	}
+	for _, name := range b.Added {
+		lines = append(lines, diffAddStyle.Render("  + "+name))
+	}
+	for _, name := range b.Removed {
+		lines = append(lines, diffDelStyle.Render("  - "+name))
+	}
+	for _, name := range b.Changed {
+		lines = append(lines, normalStyle.Render("  ~ "+name))
+	}
+	return lines
+}
+
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+func shortHash(h string) string {
+	if len(h) > 12 {
+		return h[:12]
+	}
+	return h
+}
 
-	// Apply scroll offset
+// finishDetail scrolls and truncates the detail pane's lines to fit.
+func (m Model) finishDetail(lines []string, width, height int) string {
 	if m.detailScroll > 0 && m.detailScroll < len(lines) {
 		lines = lines[m.detailScroll:]
 	}
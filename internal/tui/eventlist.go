@@ -9,7 +9,7 @@ import (
 )
 
 func (m Model) renderEventList(width, height int) string {
-	if len(m.events) == 0 {
+	if len(m.records) == 0 {
 		content := normalStyle.Render("  Watching for changes...")
 		return borderStyle.Width(width - 2).Height(height - 2).Render(content)
 	}
@@ -18,50 +18,211 @@ func (m Model) renderEventList(width, height int) string {
 	header := headerStyle.Render(" Events")
 	lines = append(lines, header)
 
-	filteredEvents := m.filteredEvents()
-
-	for i, ev := range filteredEvents {
+	for i, row := range m.rows() {
 		if i >= height-3 { // leave room for header and border
 			break
 		}
+		var line string
+		switch {
+		case row.isHeader():
+			line = formatSetLine(row, m.collapsed[row.set], width-6)
+		case row.grouped:
+			line = "│" + formatEventLine(row.rec, m.statusCode(row.rec), width-7)
+		default:
+			line = formatEventLine(row.rec, m.statusCode(row.rec), width-6)
+		}
 		if i == m.selected {
-			line := formatEventLine(ev, width-6)
 			line = selectedStyle.Width(width - 4).Render("▶ " + line)
-			lines = append(lines, line)
 		} else {
-			line := formatEventLine(ev, width-6)
 			line = normalStyle.Width(width - 4).Render("  " + line)
-			lines = append(lines, line)
 		}
+		lines = append(lines, line)
 	}
 
 	content := strings.Join(lines, "\n")
 	return borderStyle.Width(width - 2).Height(height - 2).Render(content)
 }
 
-func (m Model) filteredEvents() []types.FileEvent {
-	if m.filterText == "" {
-		return m.events
+// listRow is one line of the event list: an event, or the header of a
+// change set of several events.
+type listRow struct {
+	rec     types.Record
+	set     int            // change set ID, for headers
+	members []types.Record // a header's events, newest first
+	grouped bool           // an event listed under its change set's header
+}
+
+func (r listRow) isHeader() bool {
+	return r.members != nil
+}
+
+// rowKey identifies a row while the list changes around it.
+type rowKey struct {
+	id, set int
+}
+
+func (r listRow) key() rowKey {
+	if r.isHeader() {
+		return rowKey{set: r.set}
+	}
+	return rowKey{id: r.rec.ID}
+}
+
+// rows lays out the filtered events. When grouping, each change set with
+// more than one event gets a header, with its events listed below unless
+// it's collapsed.
+func (m Model) rows() []listRow {
+	filtered := m.filteredRecords()
+	rows := make([]listRow, 0, len(filtered))
+	for i := 0; i < len(filtered); {
+		j := i + 1
+		set := filtered[i].ChangeSet
+		for m.groupSets && set != 0 && j < len(filtered) && filtered[j].ChangeSet == set {
+			j++
+		}
+		if j-i == 1 {
+			rows = append(rows, listRow{rec: filtered[i]})
+			i = j
+			continue
+		}
+		rows = append(rows, listRow{set: set, members: filtered[i:j]})
+		if !m.collapsed[set] {
+			for _, rec := range filtered[i:j] {
+				rows = append(rows, listRow{rec: rec, grouped: true})
+			}
+		}
+		i = j
+	}
+	return rows
+}
+
+// selectedRow returns the selected row, if any.
+func (m Model) selectedRow() (listRow, bool) {
+	rows := m.rows()
+	if m.selected >= len(rows) {
+		return listRow{}, false
+	}
+	return rows[m.selected], true
+}
+
+// selectedRecord returns the selected event, unless nothing or a change set
+// is selected.
+func (m Model) selectedRecord() (types.Record, bool) {
+	row, ok := m.selectedRow()
+	if !ok || row.isHeader() {
+		return types.Record{}, false
 	}
-	var filtered []types.FileEvent
-	for _, ev := range m.events {
-		if strings.Contains(ev.Path, m.filterText) {
-			filtered = append(filtered, ev)
+	return row.rec, true
+}
+
+// keepSelection applies change to the list, keeping the selection on the
+// same row if it's still listed.
+func (m *Model) keepSelection(change func()) {
+	row, ok := m.selectedRow()
+	change()
+	rows := m.rows()
+	for i, r := range rows {
+		if ok && r.key() == row.key() {
+			m.selected = i
+			return
+		}
+	}
+	if m.selected >= len(rows) && m.selected > 0 {
+		m.selected = len(rows) - 1
+	}
+}
+
+// selectRecord selects the record with the given ID, or its change set's
+// header if the set is collapsed.
+func (m *Model) selectRecord(id int) {
+	for i, r := range m.rows() {
+		if r.key().id == id {
+			m.selected = i
+			return
+		}
+		if r.isHeader() && m.collapsed[r.set] {
+			for _, rec := range r.members {
+				if rec.ID == id {
+					m.selected = i
+					return
+				}
+			}
+		}
+	}
+	m.selected = 0
+}
+
+func (m Model) filteredRecords() []types.Record {
+	if !m.filtering() && m.showNoOps {
+		return m.records
+	}
+	var filtered []types.Record
+	for _, rec := range m.records {
+		if m.matchesFilter(rec) {
+			filtered = append(filtered, rec)
 		}
 	}
 	return filtered
 }
 
-func formatEventLine(ev types.FileEvent, maxWidth int) string {
+// filtering reports whether a text or root filter hides any events.
+func (m Model) filtering() bool {
+	return m.filterText != "" || m.rootFilter != ""
+}
+
+func (m Model) matchesFilter(rec types.Record) bool {
+	if rec.NoOp && !m.showNoOps {
+		return false
+	}
+	if m.rootFilter != "" && rec.Event.Root != m.rootFilter {
+		return false
+	}
+	return strings.Contains(rec.Event.Path, m.filterText)
+}
+
+// formatEventLine renders one event; status is the file's two-letter git
+// status code, or "" to leave the column out.
+func formatEventLine(rec types.Record, status string, maxWidth int) string {
+	ev := rec.Event
 	ts := ev.Timestamp.Format("15:04:05")
 	sym := ev.Op.Symbol()
 	path := ev.Path
+	switch {
+	case ev.Git != nil:
+		path = ev.Git.Summary
+		if ev.Root != "" {
+			path = ev.Root + ": " + path
+		}
+	case ev.IsDir:
+		path += "/"
+	case ev.Dir != "":
+		// Listed just below its directory's event
+		path = "└ " + path
+	}
 
 	suffix := ""
 	if ev.IsDebounced() {
 		suffix = fmt.Sprintf("(x%d)", ev.ChangeCount())
 	}
+	if rec.CausedBy != "" {
+		suffix += "[git]"
+	}
+	if ev.Reconciled {
+		suffix += "[rescan]"
+	}
+	if rec.NoOp {
+		suffix += "[no-op]"
+	}
+	if ev.Paused {
+		suffix += "[paused]"
+	}
+	if ev.Meta != nil && ev.Op != types.OpMeta {
+		suffix += "[meta]"
+	}
 
+	if status != "" {
+		sym = status + " " + sym
+	}
 	line := fmt.Sprintf(" %s %s %s %s", ts, sym, path, suffix)
 	if len(line) > maxWidth {
 		line = line[:maxWidth-1] + "…"
@@ -69,5 +230,35 @@ func formatEventLine(ev types.FileEvent, maxWidth int) string {
 	return line
 }
 
+// formatSetLine renders a change set's header with its combined stats.
+func formatSetLine(row listRow, collapsed bool, maxWidth int) string {
+	files, added, deleted := setStats(row.members)
+	arrow := "▾"
+	if collapsed {
+		arrow = "▸"
+	}
+	line := fmt.Sprintf(" %s %s set #%d  %d events, %d files  +%d -%d",
+		row.members[0].Event.Timestamp.Format("15:04:05"), arrow, row.set, len(row.members), files, added, deleted)
+	if len(line) > maxWidth {
+		line = line[:maxWidth-1] + "…"
+	}
+	return line
+}
+
+// setStats totals a change set's events.
+func setStats(members []types.Record) (files, added, deleted int) {
+	paths := make(map[string]bool)
+	for _, rec := range members {
+		if rec.Event.IsFile() {
+			paths[rec.Event.Path] = true
+		}
+		if rec.Diff.Available {
+			added += rec.Diff.Stats.Added
+			deleted += rec.Diff.Stats.Deleted
+		}
+	}
+	return len(paths), added, deleted
+}
+
 // Ensure lipgloss is used (referenced in renderEventList)
 var _ = lipgloss.Width
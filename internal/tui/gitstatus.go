@@ -0,0 +1,94 @@
+package tui
+
+import (
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/wgawan/agent-spy/internal/git"
+	"github.com/wgawan/agent-spy/internal/types"
+)
+
+// diffMode selects what the detail pane compares.
+type diffMode int
+
+const (
+	diffEdit    diffMode = iota // the change made by the selected event
+	diffVsIndex                 // working tree vs index: what is unstaged
+	diffVsHead                  // working tree vs HEAD: what is uncommitted
+	numDiffModes
+)
+
+func (d diffMode) String() string {
+	switch d {
+	case diffVsIndex:
+		return "vs index"
+	case diffVsHead:
+		return "vs HEAD"
+	default:
+		return "edit"
+	}
+}
+
+func (d diffMode) base() git.DiffBase {
+	if d == diffVsHead {
+		return git.BaseHead
+	}
+	return git.BaseIndex
+}
+
+// gitStatusMsg carries a fresh `git status` snapshot.
+type gitStatusMsg struct {
+	status map[string]git.FileStatus
+	err    error
+}
+
+// altDiffKey identifies a working tree diff shown in the detail pane.
+type altDiffKey struct {
+	path string
+	mode diffMode
+}
+
+type altDiffMsg struct {
+	key  altDiffKey
+	diff types.DiffResult
+}
+
+func (m Model) loadGitStatus() tea.Cmd {
+	load := m.gitStatus
+	return func() tea.Msg {
+		status, err := load()
+		return gitStatusMsg{status: status, err: err}
+	}
+}
+
+// syncAltDiff requests the working tree diff for the selected file when
+// the detail pane shows one and it isn't loaded or loading already.
+func (m *Model) syncAltDiff() tea.Cmd {
+	if m.diffMode == diffEdit || m.diffAgainst == nil || m.checkpointMode {
+		return nil
+	}
+	rec, ok := m.selectedRecord()
+	if !ok || !rec.Event.IsFile() {
+		return nil
+	}
+	key := altDiffKey{path: rec.Event.Path, mode: m.diffMode}
+	if key == m.altRequested {
+		return nil
+	}
+	m.altRequested = key
+	diffAgainst := m.diffAgainst
+	return func() tea.Msg {
+		diff, err := diffAgainst(key.path, key.mode.base())
+		if err != nil {
+			diff = types.DiffResult{Available: false, Error: err.Error()}
+		}
+		return altDiffMsg{key: key, diff: diff}
+	}
+}
+
+// statusCode is the porcelain status shown next to an event, or "" when
+// git status isn't available.
+func (m Model) statusCode(rec types.Record) string {
+	if m.fileStatus == nil || !rec.Event.IsFile() {
+		return ""
+	}
+	return m.fileStatus[rec.Event.Path].Code()
+}
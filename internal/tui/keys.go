@@ -0,0 +1,95 @@
+package tui
+
+import (
+	"fmt"
+	"sort"
+)
+
+// DefaultKeys binds each action that can be rebound to its default key.
+// Arrow keys, ctrl+c, space and esc keep working whatever the bindings.
+var DefaultKeys = map[string]string{
+	"quit":        "q",
+	"up":          "k",
+	"down":        "j",
+	"auto-scroll": "a",
+	"fullscreen":  "F",
+	"filter":      "f",
+	"root":        "R",
+	"no-ops":      "m",
+	"change-sets": "g",
+	"fold":        "enter",
+	"pause":       "p",
+	"clear":       "c",
+	"export":      "e",
+	"summary":     "s",
+	"checkpoints": "C",
+	"diff-mode":   "d",
+	"scroll-down": "ctrl+d",
+	"scroll-up":   "ctrl+u",
+}
+
+// keyMap translates the keys pressed into the default keys of the actions
+// they are bound to, which is what the key handlers match on.
+type keyMap struct {
+	pressed map[string]string // bound key -> default key, "" if unbound
+	labels  map[string]string // default key -> bound key, for the help bar
+}
+
+// CheckKeys reports bindings to unknown actions and keys bound to more than
+// one action.
+func CheckKeys(bindings map[string]string) error {
+	_, err := newKeyMap(bindings)
+	return err
+}
+
+func newKeyMap(bindings map[string]string) (keyMap, error) {
+	km := keyMap{pressed: make(map[string]string), labels: make(map[string]string)}
+	for action := range bindings {
+		if _, ok := DefaultKeys[action]; !ok {
+			return km, fmt.Errorf("keys: unknown action %q", action)
+		}
+	}
+	actions := make([]string, 0, len(DefaultKeys))
+	for action := range DefaultKeys {
+		actions = append(actions, action)
+	}
+	sort.Strings(actions)
+
+	owner := make(map[string]string)
+	for _, action := range actions {
+		def, key := DefaultKeys[action], DefaultKeys[action]
+		if k, ok := bindings[action]; ok && k != "" {
+			key = k
+		}
+		if other, ok := owner[key]; ok {
+			return km, fmt.Errorf("keys: %s and %s are both bound to %q", other, action, key)
+		}
+		owner[key] = action
+		km.labels[def] = key
+		if key != def {
+			km.pressed[def] = "" // moved away, unless taken below
+		}
+	}
+	for key, action := range owner {
+		if def := DefaultKeys[action]; def != key {
+			km.pressed[key] = def
+		}
+	}
+	return km, nil
+}
+
+// action returns the default key for the key pressed.
+func (km keyMap) action(key string) string {
+	if def, ok := km.pressed[key]; ok {
+		return def
+	}
+	return key
+}
+
+// label returns the key bound to the action whose default key is def.
+func (km keyMap) label(def string) string {
+	if key, ok := km.labels[def]; ok {
+		return key
+	}
+	return def
+}
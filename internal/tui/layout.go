@@ -15,9 +15,14 @@ func (m Model) renderLayout() string {
 
 	contentHeight := m.height - statsHeight - helpHeight
 
+	renderList, renderDetail := m.renderEventList, m.renderDetail
+	if m.checkpointMode {
+		renderList, renderDetail = m.renderCheckpointList, m.renderCheckpointDiff
+	}
+
 	if m.fullscreen {
 		// Detail pane takes over everything below stats bar
-		detail := m.renderDetail(m.width, contentHeight)
+		detail := renderDetail(m.width, contentHeight)
 		return strings.Join([]string{statsBar, detail, helpBar}, "\n")
 	}
 
@@ -25,8 +30,8 @@ func (m Model) renderLayout() string {
 	eventWidth := m.width * 35 / 100
 	detailWidth := m.width - eventWidth
 
-	eventList := m.renderEventList(eventWidth, contentHeight)
-	detail := m.renderDetail(detailWidth, contentHeight)
+	eventList := renderList(eventWidth, contentHeight)
+	detail := renderDetail(detailWidth, contentHeight)
 
 	content := lipgloss.JoinHorizontal(lipgloss.Top, eventList, detail)
 
@@ -39,11 +44,60 @@ func (m Model) renderHelp() string {
 			" filter: " + m.filterText + "█  [enter: apply] [esc: cancel]",
 		)
 	}
+	if m.status != "" {
+		return helpStyle.Width(m.width).Render(" " + m.status)
+	}
+	if m.checkpointMode {
+		return helpStyle.Width(m.width).Render(
+			" ↑↓:select  space:mark base  r:restore  F:fullscreen  ctrl+d/u:scroll  C/esc:back  q:quit",
+		)
+	}
 	autoScrollStatus := "off"
 	if m.autoScroll {
 		autoScrollStatus = "on"
 	}
-	return helpStyle.Width(m.width).Render(
-		" ↑↓:select  a:auto-scroll[" + autoScrollStatus + "]  F:fullscreen  f:filter  c:clear  ctrl+d/u:scroll  q:quit",
-	)
+	k := m.keys.label
+	help := " ↑↓:select  " + k("a") + ":auto-scroll[" + autoScrollStatus + "]  " + k("F") + ":fullscreen  " + k("f") + ":filter"
+	// Only advertise keys whose features are enabled
+	if len(m.roots) > 0 {
+		root := m.rootFilter
+		if root == "" {
+			root = "all"
+		}
+		help += "  " + k("R") + ":root[" + root + "]"
+	}
+	if m.groupSets {
+		help += "  " + k("g") + ":sets[on]  " + k("enter") + ":fold"
+	} else {
+		help += "  " + k("g") + ":sets[off]"
+	}
+	if m.showNoOps {
+		help += "  " + k("m") + ":no-ops[shown]"
+	} else {
+		help += "  " + k("m") + ":no-ops[hidden]"
+	}
+	if m.exportPatch != nil {
+		help += "  " + k("e") + ":export"
+	}
+	if m.diffAgainst != nil {
+		help += "  " + k("d") + ":diff[" + m.diffMode.String() + "]"
+	}
+	if m.writeSummary != nil {
+		help += "  " + k("s") + ":summary"
+	}
+	if m.checkpoints != nil {
+		help += "  " + k("C") + ":checkpoints"
+	}
+	if m.pause != nil {
+		if m.pause.Paused() {
+			help += "  " + k("p") + ":resume"
+		} else {
+			help += "  " + k("p") + ":pause"
+		}
+	}
+	scroll := "ctrl+d/u"
+	if k("ctrl+d") != "ctrl+d" || k("ctrl+u") != "ctrl+u" {
+		scroll = k("ctrl+d") + "/" + k("ctrl+u")
+	}
+	return helpStyle.Width(m.width).Render(help + "  " + k("c") + ":clear  " + scroll + ":scroll  " + k("q") + ":quit")
 }
@@ -1,57 +1,169 @@
 package tui
 
 import (
+	"os"
+	"path/filepath"
 	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/wgawan/agent-spy/internal/bus"
+	"github.com/wgawan/agent-spy/internal/git"
+	"github.com/wgawan/agent-spy/internal/store"
 	"github.com/wgawan/agent-spy/internal/types"
 )
 
 type Model struct {
-	events       []types.FileEvent
-	diffs        []types.DiffResult // snapshot of diff at time each event arrived
-	eventsChan   chan types.FileEvent
+	records      []types.Record // newest first
+	recordsChan  <-chan types.Record
+	bus          *bus.Bus
 	selected     int
 	width        int
 	height       int
 	fullscreen   bool
 	filterMode   bool
 	filterText   string
-	startTime    time.Time
-	totalAdded   int
-	totalDeleted int
-	uniqueFiles  map[string]bool
+	roots        []Root
+	rootFilter   string // show only this root's events; "" for all
+	showNoOps    bool   // list writes that left the content unchanged
+	groupSets    bool   // group events into their change sets
+	collapsed    map[int]bool
+	store        *store.Store
 	gitBranch    string
 	gitAvailable bool
+	polling      bool
 	watchPath    string
-	diffFn       func(string) (types.DiffResult, error)
-	currentDiff  types.DiffResult
 	detailScroll int
 	autoScroll   bool
 	quitting     bool
+	exportPatch  func(include func(string) bool) (string, error)
+	exportDir    string
+	writeSummary func() (string, error)
+	pause        Pauser
+	keys         keyMap
+	baseline     func() (done, total int)
+	status       string // one-off message shown in the help bar
+	alertsSeen   int
+	clearedAt    int // last record ID when the list was cleared
+	alertsClear  int // alerts raised before then
+
+	// Git status and working tree diffs
+	gitStatus     func() (map[string]git.FileStatus, error)
+	diffAgainst   func(path string, base git.DiffBase) (types.DiffResult, error)
+	fileStatus    map[string]git.FileStatus
+	statusDirty   bool
+	statusLoading bool
+	diffMode      diffMode
+	altRequested  altDiffKey
+	altLoaded     altDiffKey
+	altDiff       types.DiffResult
+
+	// Checkpoint view
+	checkpoints    Checkpoints
+	checkpointMode bool
+	cpSelected     int // checkpoint N, 0 if none
+	cpBase         int // marked base to diff against, -1 for the previous one
+	cpDiff         string
+	cpDiffErr      error
+	cpDiffFrom     int
+	cpDiffTo       int
+	confirmRestore bool
+}
+
+// Pauser pauses and resumes event capture.
+type Pauser interface {
+	Paused() bool
+	SetPaused(paused bool)
+}
+
+// Root is one of several watched roots.
+type Root struct {
+	Label  string
+	Branch string // "" outside git
 }
 
-type fileEventMsg types.FileEvent
+type Config struct {
+	Records      <-chan types.Record // subscription to the event bus
+	Bus          *bus.Bus            // for drop metrics in the stats bar
+	Store        *store.Store
+	WatchPath    string
+	GitBranch    string
+	GitAvailable bool
+	// Polling is set when any root is watched by stat polling rather than
+	// OS notifications.
+	Polling bool
+	// Roots lists the watched roots when there are several, enabling per-root
+	// totals and the root filter.
+	Roots []Root
+	// ExportPatch builds the session patch; nil disables the export key.
+	ExportPatch func(include func(string) bool) (string, error)
+	ExportDir   string // where exported files are written
+	// WriteSummary writes the Markdown session summary and returns the file
+	// it wrote; nil disables the summary key.
+	WriteSummary func() (string, error)
+	// Checkpoints enables the checkpoint view; may be nil.
+	Checkpoints Checkpoints
+	// Pause enables the pause key; may be nil.
+	Pause Pauser
+	// Keys rebinds actions to other keys, by the names in DefaultKeys.
+	// Check them with CheckKeys first; invalid bindings are ignored.
+	Keys map[string]string
+	// Baseline reports progress loading the startup baseline; nil without
+	// one.
+	Baseline func() (done, total int)
+	// GitStatus and DiffAgainst enable per-file status and the working
+	// tree diff modes; both nil without git.
+	GitStatus   func() (map[string]git.FileStatus, error)
+	DiffAgainst func(path string, base git.DiffBase) (types.DiffResult, error)
+}
+
+// fileEventMsg announces a new event whose diff is still being computed;
+// diffReadyMsg carries the finished record.
+type fileEventMsg types.Record
+type diffReadyMsg types.Record
 type tickMsg time.Time
+type statusMsg string
 
-func New(eventsChan chan types.FileEvent, watchPath string, gitBranch string, gitAvailable bool, diffFn func(string) (types.DiffResult, error)) Model {
+func New(cfg Config) Model {
+	keys, err := newKeyMap(cfg.Keys)
+	if err != nil {
+		keys, _ = newKeyMap(nil)
+	}
 	return Model{
-		events:       make([]types.FileEvent, 0),
-		diffs:        make([]types.DiffResult, 0),
-		eventsChan:   eventsChan,
-		uniqueFiles:  make(map[string]bool),
-		startTime:    time.Now(),
-		gitBranch:    gitBranch,
-		gitAvailable: gitAvailable,
-		watchPath:    watchPath,
-		diffFn:       diffFn,
+		keys:         keys,
+		records:      make([]types.Record, 0),
+		recordsChan:  cfg.Records,
+		bus:          cfg.Bus,
+		store:        cfg.Store,
+		gitBranch:    cfg.GitBranch,
+		gitAvailable: cfg.GitAvailable,
+		roots:        cfg.Roots,
+		polling:      cfg.Polling,
+		watchPath:    cfg.WatchPath,
+		exportPatch:  cfg.ExportPatch,
+		exportDir:    cfg.ExportDir,
+		writeSummary: cfg.WriteSummary,
+		checkpoints:  cfg.Checkpoints,
+		pause:        cfg.Pause,
+		baseline:     cfg.Baseline,
+		gitStatus:    cfg.GitStatus,
+		diffAgainst:  cfg.DiffAgainst,
+		statusDirty:  true,
+		groupSets:    true,
+		cpBase:       -1,
+		cpDiffFrom:   -1,
 	}
 }
 
-func waitForEvent(ch chan types.FileEvent) tea.Cmd {
+func waitForEvent(ch <-chan types.Record) tea.Cmd {
 	return func() tea.Msg {
-		ev := <-ch
-		return fileEventMsg(ev)
+		rec, ok := <-ch
+		if !ok {
+			return nil
+		}
+		if rec.Pending {
+			return fileEventMsg(rec)
+		}
+		return diffReadyMsg(rec)
 	}
 }
 
@@ -62,53 +174,150 @@ func tick() tea.Cmd {
 }
 
 func (m Model) Init() tea.Cmd {
-	return tea.Batch(waitForEvent(m.eventsChan), tick())
-}
-
-func (m Model) fetchDiff(path string) types.DiffResult {
-	if m.diffFn == nil {
-		return types.DiffResult{}
-	}
-	diff, _ := m.diffFn(path)
-	return diff
+	return tea.Batch(waitForEvent(m.recordsChan), tick())
 }
 
 func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
-		return m.handleKey(msg)
+		next, cmd := m.handleKey(msg)
+		nm := next.(Model)
+		return nm, tea.Batch(cmd, nm.syncAltDiff())
 	case tea.WindowSizeMsg:
 		m.width = msg.Width
 		m.height = msg.Height
 		return m, nil
 	case fileEventMsg:
-		ev := types.FileEvent(msg)
-		// Snapshot the diff at this moment
-		diff := m.fetchDiff(ev.Path)
-		// Prepend event and its diff (newest first)
-		m.events = append([]types.FileEvent{ev}, m.events...)
-		m.diffs = append([]types.DiffResult{diff}, m.diffs...)
-		m.uniqueFiles[ev.Path] = true
-		if diff.Available {
-			m.totalAdded += diff.Stats.Added
-			m.totalDeleted += diff.Stats.Deleted
-		}
-		if m.autoScroll || len(m.events) == 1 {
-			// Jump to newest event
-			m.selected = 0
-			m.currentDiff = diff
-			m.detailScroll = 0
-		} else {
-			// Keep selection on the same event (shift down since we prepended)
-			m.selected++
+		if msg.ID <= m.clearedAt {
+			return m, waitForEvent(m.recordsChan)
+		}
+		m.addRecord(types.Record(msg))
+		m.statusDirty = true
+		return m, tea.Batch(waitForEvent(m.recordsChan), m.syncAltDiff())
+	case diffReadyMsg:
+		rec := types.Record(msg)
+		if rec.Event.Git != nil && rec.Event.Git.Branch != "" {
+			m.setBranch(rec.Event.Root, rec.Event.Git.Branch)
+		}
+		replaced := false
+		m.keepSelection(func() { replaced = m.replaceRecord(rec) })
+		if !replaced && !rec.Event.IsFile() && rec.ID > m.clearedAt {
+			// Published without a pending phase (no diff to compute). A
+			// file change that isn't listed was cleared while pending.
+			m.addRecord(rec)
+		}
+		m.statusDirty = true
+		if rec.Event.Path == m.altRequested.path || rec.Event.Op == types.OpGit {
+			m.altRequested = altDiffKey{} // content changed; reload
+		}
+		return m, tea.Batch(waitForEvent(m.recordsChan), m.syncAltDiff())
+	case statusMsg:
+		m.status = string(msg)
+		return m, nil
+	case checkpointDiffMsg:
+		if from, to := m.checkpointDiffRange(); msg.from != from || msg.to != to {
+			return m, nil // selection moved on
+		}
+		m.cpDiffFrom, m.cpDiffTo = msg.from, msg.to
+		m.cpDiff, m.cpDiffErr = msg.diff, msg.err
+		return m, nil
+	case gitStatusMsg:
+		m.statusLoading = false
+		if msg.err == nil {
+			m.fileStatus = msg.status
+		}
+		return m, nil
+	case altDiffMsg:
+		if msg.key == m.altRequested {
+			m.altLoaded, m.altDiff = msg.key, msg.diff
 		}
-		return m, waitForEvent(m.eventsChan)
+		return m, nil
 	case tickMsg:
+		m.showNewAlert()
+		// Refresh git status at most once a second, and only after changes.
+		if m.gitStatus != nil && m.statusDirty && !m.statusLoading {
+			m.statusDirty, m.statusLoading = false, true
+			return m, tea.Batch(tick(), m.loadGitStatus())
+		}
 		return m, tick()
 	}
 	return m, nil
 }
 
+func (m *Model) addRecord(rec types.Record) {
+	// Prepend (newest first)
+	prepend := func() { m.records = append([]types.Record{rec}, m.records...) }
+	if m.autoScroll || len(m.records) == 0 {
+		// Jump to newest event
+		prepend()
+		m.selectRecord(rec.ID)
+		m.detailScroll = 0
+		return
+	}
+	m.keepSelection(prepend)
+}
+
+// showNewAlert puts the latest alert in the help bar when one was raised
+// since the last tick.
+func (m *Model) showNewAlert() {
+	alerts := m.store.Alerts()
+	if len(alerts) > m.alertsSeen {
+		m.status = "⚠ " + alerts[len(alerts)-1].Message
+	}
+	m.alertsSeen = len(alerts)
+}
+
+// setBranch records a branch change in the given root.
+func (m *Model) setBranch(root, branch string) {
+	if root == "" {
+		m.gitBranch = branch
+		return
+	}
+	roots := append([]Root(nil), m.roots...)
+	for i := range roots {
+		if roots[i].Label == root {
+			roots[i].Branch = branch
+		}
+	}
+	m.roots = roots
+}
+
+// toggleCollapsed collapses or expands the change set of the selected row,
+// leaving its header selected.
+func (m *Model) toggleCollapsed() {
+	row, ok := m.selectedRow()
+	if !ok || (!row.isHeader() && !row.grouped) {
+		return
+	}
+	set := row.set
+	if !row.isHeader() {
+		set = row.rec.ChangeSet
+	}
+	collapsed := make(map[int]bool, len(m.collapsed)+1)
+	for id, c := range m.collapsed {
+		collapsed[id] = c
+	}
+	collapsed[set] = !collapsed[set]
+	m.collapsed = collapsed
+	for i, r := range m.rows() {
+		if r.isHeader() && r.set == set {
+			m.selected = i
+		}
+	}
+	m.detailScroll = 0
+}
+
+// replaceRecord swaps in the finished version of a pending record.
+func (m *Model) replaceRecord(rec types.Record) bool {
+	for i := range m.records {
+		if m.records[i].ID == rec.ID {
+			m.records[i] = rec
+			return true
+		}
+	}
+	return false
+}
+
 func (m Model) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	if m.filterMode {
 		switch msg.String() {
@@ -118,41 +327,44 @@ func (m Model) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		case "backspace":
 			if len(m.filterText) > 0 {
 				m.filterText = m.filterText[:len(m.filterText)-1]
+				m.selected = 0
 			}
 			return m, nil
 		default:
 			if len(msg.String()) == 1 {
 				m.filterText += msg.String()
+				m.selected = 0
 			}
 			return m, nil
 		}
 	}
 
-	switch msg.String() {
+	m.status = ""
+	if m.checkpointMode {
+		return m.handleCheckpointKey(msg)
+	}
+	switch m.keys.action(msg.String()) {
 	case "q", "ctrl+c":
 		m.quitting = true
 		return m, tea.Quit
 	case "up", "k":
 		if m.selected > 0 {
 			m.selected--
-			m.currentDiff = m.diffs[m.selected]
 			m.detailScroll = 0
 			m.autoScroll = false
 		}
 		return m, nil
 	case "down", "j":
-		if m.selected < len(m.events)-1 {
+		if m.selected < len(m.rows())-1 {
 			m.selected++
-			m.currentDiff = m.diffs[m.selected]
 			m.detailScroll = 0
 			m.autoScroll = false
 		}
 		return m, nil
 	case "a":
 		m.autoScroll = !m.autoScroll
-		if m.autoScroll && len(m.events) > 0 {
+		if m.autoScroll {
 			m.selected = 0
-			m.currentDiff = m.diffs[0]
 			m.detailScroll = 0
 		}
 		return m, nil
@@ -167,15 +379,90 @@ func (m Model) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	case "f":
 		m.filterMode = true
 		m.filterText = ""
+		m.selected = 0
 		return m, nil
+	case "m":
+		m.showNoOps = !m.showNoOps
+		m.selected = 0
+		m.detailScroll = 0
+		return m, nil
+	case "g":
+		m.keepSelection(func() { m.groupSets = !m.groupSets })
+		m.detailScroll = 0
+		return m, nil
+	case "enter", " ":
+		m.toggleCollapsed()
+		return m, nil
+	case "R":
+		if len(m.roots) == 0 {
+			return m, nil
+		}
+		m.rootFilter = nextRoot(m.roots, m.rootFilter)
+		m.selected = 0
+		m.detailScroll = 0
+		return m, nil
+	case "p":
+		if m.pause == nil {
+			return m, nil
+		}
+		// Resuming sends the changes held while paused, which can block
+		// until Update drains the records they produce, so it runs in a
+		// command.
+		pause := m.pause
+		return m, func() tea.Msg {
+			if pause.Paused() {
+				pause.SetPaused(false)
+				return statusMsg("capture resumed")
+			}
+			pause.SetPaused(true)
+			return statusMsg("capture paused; your edits won't be recorded")
+		}
 	case "c":
-		m.events = nil
-		m.diffs = nil
+		// Only the list is cleared; the store keeps the session for the
+		// API, summaries and exports.
+		m.records = nil
 		m.selected = 0
-		m.uniqueFiles = make(map[string]bool)
-		m.totalAdded = 0
-		m.totalDeleted = 0
-		m.currentDiff = types.DiffResult{}
+		m.clearedAt = m.store.LastID()
+		m.alertsClear = len(m.store.Alerts())
+		return m, nil
+	case "e":
+		if m.exportPatch == nil {
+			m.status = "patch export requires git"
+			return m, nil
+		}
+		return m, m.exportSessionPatch()
+	case "s":
+		if m.writeSummary == nil {
+			return m, nil
+		}
+		write := m.writeSummary
+		return m, func() tea.Msg {
+			name, err := write()
+			if err != nil {
+				return statusMsg("summary failed: " + err.Error())
+			}
+			return statusMsg("summary written to " + name)
+		}
+	case "C":
+		if m.checkpoints == nil {
+			m.status = "checkpoints are off (start with --checkpoint)"
+			return m, nil
+		}
+		m.checkpointMode = true
+		m.detailScroll = 0
+		m.cpBase = -1
+		m.cpSelected = len(m.checkpoints.List())
+		if m.cpSelected == 0 {
+			return m, nil
+		}
+		return m, m.loadCheckpointDiff()
+	case "d":
+		if m.diffAgainst == nil {
+			m.status = "working tree diffs require git"
+			return m, nil
+		}
+		m.diffMode = (m.diffMode + 1) % numDiffModes
+		m.detailScroll = 0
 		return m, nil
 	case "ctrl+d":
 		m.detailScroll++
@@ -189,6 +476,47 @@ func (m Model) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	return m, nil
 }
 
+// exportSessionPatch writes the session patch to a timestamped file, limited
+// to the filtered events when a filter is active.
+func (m Model) exportSessionPatch() tea.Cmd {
+	var include func(string) bool
+	if m.filtering() {
+		paths := make(map[string]bool)
+		for _, rec := range m.filteredRecords() {
+			paths[rec.Event.Path] = true
+		}
+		include = func(path string) bool { return paths[path] }
+	}
+	build, dir := m.exportPatch, m.exportDir
+	return func() tea.Msg {
+		patch, err := build(include)
+		if err != nil {
+			return statusMsg("export failed: " + err.Error())
+		}
+		if patch == "" {
+			return statusMsg("nothing to export")
+		}
+		name := filepath.Join(dir, "agent-spy-"+time.Now().Format("20060102-150405")+".patch")
+		if err := os.WriteFile(name, []byte(patch), 0644); err != nil {
+			return statusMsg("export failed: " + err.Error())
+		}
+		return statusMsg("patch written to " + name)
+	}
+}
+
+// nextRoot cycles the root filter: all roots, then each root in turn.
+func nextRoot(roots []Root, current string) string {
+	if current == "" {
+		return roots[0].Label
+	}
+	for i, r := range roots {
+		if r.Label == current && i+1 < len(roots) {
+			return roots[i+1].Label
+		}
+	}
+	return ""
+}
+
 func (m Model) View() string {
 	if m.quitting {
 		return ""
@@ -5,20 +5,50 @@ import (
 	"time"
 
 	"github.com/charmbracelet/lipgloss"
+	"github.com/wgawan/agent-spy/internal/store"
 )
 
 func (m Model) renderStatsBar() string {
-	elapsed := time.Since(m.startTime)
+	st := m.store.StatsSince(m.clearedAt)
+	elapsed := time.Since(st.StartTime)
 	elapsedStr := formatDuration(elapsed)
 
-	fileCount := fmt.Sprintf("%d files", len(m.uniqueFiles))
-	changes := fmt.Sprintf("+%d -%d", m.totalAdded, m.totalDeleted)
+	fileCount := fmt.Sprintf("%d files", st.Files)
+	changes := fmt.Sprintf("+%d -%d", st.Added, st.Deleted)
 	timer := fmt.Sprintf("▶ %s", elapsedStr)
+	if m.pause != nil && m.pause.Paused() {
+		timer = fmt.Sprintf("⏸ %s paused", elapsedStr)
+	}
 
 	parts := []string{fileCount, changes, timer}
-	if m.gitAvailable && m.gitBranch != "" {
+	if st.NoOps > 0 {
+		state := "hidden"
+		if m.showNoOps {
+			state = "shown"
+		}
+		parts = append(parts, fmt.Sprintf("%d no-op %s", st.NoOps, state))
+	}
+	if len(m.roots) > 0 {
+		parts = append(parts, m.rootTotals(st)...)
+	} else if m.gitAvailable && m.gitBranch != "" {
 		parts = append(parts, fmt.Sprintf("git:%s", m.gitBranch))
 	}
+	if n := len(m.store.Alerts()) - m.alertsClear; n > 0 {
+		parts = append(parts, fmt.Sprintf("⚠ %d alerts", n))
+	}
+	if m.baseline != nil {
+		if done, total := m.baseline(); done < total {
+			parts = append(parts, fmt.Sprintf("baseline %d/%d", done, total))
+		}
+	}
+	if m.polling {
+		parts = append(parts, "polling")
+	}
+	if m.bus != nil {
+		if dropped := m.bus.Dropped(); dropped > 0 {
+			parts = append(parts, fmt.Sprintf("%d dropped", dropped))
+		}
+	}
 
 	title := titleStyle.Render(fmt.Sprintf(" agent-spy: %s ", m.watchPath))
 
@@ -34,6 +64,28 @@ func (m Model) renderStatsBar() string {
 	return lipgloss.JoinHorizontal(lipgloss.Top, title, stats)
 }
 
+// rootTotals renders "label:branch +a -d" for each watched root, marking the
+// one the list is filtered to.
+func (m Model) rootTotals(st store.Stats) []string {
+	totals := make(map[string]store.RootStats)
+	for _, rs := range st.Roots {
+		totals[rs.Root] = rs
+	}
+	var parts []string
+	for _, r := range m.roots {
+		label := r.Label
+		if r.Branch != "" {
+			label += ":" + r.Branch
+		}
+		if r.Label == m.rootFilter {
+			label = "▶" + label
+		}
+		rs := totals[r.Label]
+		parts = append(parts, fmt.Sprintf("%s +%d -%d", label, rs.Added, rs.Deleted))
+	}
+	return parts
+}
+
 func formatDuration(d time.Duration) string {
 	d = d.Round(time.Second)
 	m := int(d.Minutes())
@@ -0,0 +1,54 @@
+package tui
+
+import (
+	"fmt"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// DefaultTheme holds the colors that can be changed, as ANSI color numbers.
+// Hex values such as "#5f5fd7" work too.
+var DefaultTheme = map[string]string{
+	"accent":  "62",  // title, selection, borders and headers
+	"text":    "252", // events and diff context
+	"muted":   "241", // help bar
+	"bar":     "236", // stats bar background
+	"added":   "10",
+	"deleted": "9",
+	"hunk":    "14", // diff hunk headers
+}
+
+// ApplyTheme recolors the interface. Colors left out keep their default.
+// It must be called before the program starts.
+func ApplyTheme(colors map[string]string) error {
+	for name := range colors {
+		if _, ok := DefaultTheme[name]; !ok {
+			return fmt.Errorf("theme: unknown color %q", name)
+		}
+	}
+	color := func(name string) lipgloss.Color {
+		if c, ok := colors[name]; ok {
+			return lipgloss.Color(c)
+		}
+		return lipgloss.Color(DefaultTheme[name])
+	}
+
+	accent := color("accent")
+	titleStyle = titleStyle.Background(accent)
+	selectedStyle = selectedStyle.Background(accent)
+	borderStyle = borderStyle.BorderForeground(accent)
+	headerStyle = headerStyle.Foreground(accent)
+
+	text := color("text")
+	statsStyle = statsStyle.Foreground(text).Background(color("bar"))
+	normalStyle = normalStyle.Foreground(text)
+	diffContextStyle = diffContextStyle.Foreground(text)
+
+	helpStyle = helpStyle.Foreground(color("muted"))
+	addedStyle = addedStyle.Foreground(color("added"))
+	diffAddStyle = diffAddStyle.Foreground(color("added"))
+	deletedStyle = deletedStyle.Foreground(color("deleted"))
+	diffDelStyle = diffDelStyle.Foreground(color("deleted"))
+	diffHunkStyle = diffHunkStyle.Foreground(color("hunk"))
+	return nil
+}
@@ -1,6 +1,10 @@
 package types
 
-import "time"
+import (
+	"fmt"
+	"strings"
+	"time"
+)
 
 type Operation int
 
@@ -9,6 +13,8 @@ const (
 	OpModify
 	OpDelete
 	OpRename
+	OpGit  // a git operation; details in FileEvent.Git
+	OpMeta // permissions, owner or symlink target changed; details in FileEvent.Meta
 )
 
 func (o Operation) String() string {
@@ -21,11 +27,30 @@ func (o Operation) String() string {
 		return "DELETE"
 	case OpRename:
 		return "RENAME"
+	case OpGit:
+		return "GIT"
+	case OpMeta:
+		return "META"
 	default:
 		return "UNKNOWN"
 	}
 }
 
+// MarshalText encodes the operation by name so JSON output is readable.
+func (o Operation) MarshalText() ([]byte, error) {
+	return []byte(o.String()), nil
+}
+
+func (o *Operation) UnmarshalText(text []byte) error {
+	for _, op := range []Operation{OpCreate, OpModify, OpDelete, OpRename, OpGit, OpMeta} {
+		if op.String() == string(text) {
+			*o = op
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown operation %q", text)
+}
+
 func (o Operation) Symbol() string {
 	switch o {
 	case OpCreate:
@@ -36,16 +61,74 @@ func (o Operation) Symbol() string {
 		return "D"
 	case OpRename:
 		return "R"
+	case OpGit:
+		return "G"
+	case OpMeta:
+		return "P"
 	default:
 		return "?"
 	}
 }
 
+// FileEvent is a change to one file. When several roots are watched, Root
+// labels the root the file belongs to and Path starts with that label.
+//
+// Removing or moving a directory produces an event per file inside it, with
+// Dir set to the directory, followed by one IsDir event for the directory.
 type FileEvent struct {
-	Path      string
-	Op        Operation
-	Timestamp time.Time
-	SubEvents []FileEvent
+	Root       string      `json:"root,omitempty"`
+	Path       string      `json:"path"`
+	Op         Operation   `json:"op"`
+	Timestamp  time.Time   `json:"timestamp"`
+	SubEvents  []FileEvent `json:"sub_events,omitempty"`
+	Git        *GitOp      `json:"git,omitempty"`        // set for OpGit
+	Reconciled bool        `json:"reconciled,omitempty"` // missed by the watcher, found by a rescan
+	IsDir      bool        `json:"is_dir,omitempty"`     // a removed or moved directory
+	Dir        string      `json:"dir,omitempty"`        // the removed or moved directory this file was in
+	Meta       *MetaChange `json:"meta,omitempty"`       // set for OpMeta, and when a write also changed metadata
+	Paused     bool        `json:"paused,omitempty"`     // the net change to a path while capture was paused
+}
+
+// MetaChange is a change to a file's metadata. Fields that didn't change are
+// left empty.
+type MetaChange struct {
+	OldMode   string `json:"old_mode,omitempty"` // e.g. "-rw-r--r--"
+	NewMode   string `json:"new_mode,omitempty"`
+	OldOwner  string `json:"old_owner,omitempty"` // "user:group"
+	NewOwner  string `json:"new_owner,omitempty"`
+	OldTarget string `json:"old_target,omitempty"` // symlink target
+	NewTarget string `json:"new_target,omitempty"`
+}
+
+// Summary describes the change in one line, e.g.
+// "mode -rw-r--r-- → -rwxr-xr-x".
+func (m MetaChange) Summary() string {
+	var parts []string
+	if m.OldMode != "" || m.NewMode != "" {
+		parts = append(parts, fmt.Sprintf("mode %s → %s", m.OldMode, m.NewMode))
+	}
+	if m.OldOwner != "" || m.NewOwner != "" {
+		parts = append(parts, fmt.Sprintf("owner %s → %s", m.OldOwner, m.NewOwner))
+	}
+	if m.OldTarget != "" || m.NewTarget != "" {
+		parts = append(parts, fmt.Sprintf("target %s → %s", m.OldTarget, m.NewTarget))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// GitOp is a git operation detected during the session, such as a commit,
+// checkout, reset or rebase.
+type GitOp struct {
+	Kind    string `json:"kind"`    // "commit", "checkout", "reset", "rebase", ...
+	Summary string `json:"summary"` // e.g. "commit abc1234: fix parser"
+	Head    string `json:"head,omitempty"`
+	Branch  string `json:"branch,omitempty"` // branch checked out afterwards
+}
+
+// IsFile reports whether the event changed a file's content, as opposed to
+// being a git operation or a directory event.
+func (e FileEvent) IsFile() bool {
+	return e.Op != OpGit && !e.IsDir
 }
 
 func (e FileEvent) IsDebounced() bool {
@@ -60,13 +143,13 @@ func (e FileEvent) ChangeCount() int {
 }
 
 type DiffHunk struct {
-	Header string
-	Lines  []DiffLine
+	Header string     `json:"header"`
+	Lines  []DiffLine `json:"lines"`
 }
 
 type DiffLine struct {
-	Content string
-	Type    DiffLineType
+	Content string       `json:"content"`
+	Type    DiffLineType `json:"type"`
 }
 
 type DiffLineType int
@@ -77,14 +160,137 @@ const (
 	DiffLineDelete
 )
 
+func (t DiffLineType) String() string {
+	switch t {
+	case DiffLineAdd:
+		return "add"
+	case DiffLineDelete:
+		return "delete"
+	default:
+		return "context"
+	}
+}
+
+func (t DiffLineType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+func (t *DiffLineType) UnmarshalText(text []byte) error {
+	for _, lt := range []DiffLineType{DiffLineContext, DiffLineAdd, DiffLineDelete} {
+		if lt.String() == string(text) {
+			*t = lt
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown diff line type %q", text)
+}
+
 type DiffStats struct {
-	Added   int
-	Deleted int
+	Added   int `json:"added"`
+	Deleted int `json:"deleted"`
 }
 
+// DiffResult is a file's diff. Binary files and files too large to diff have
+// no hunks; Binary summarizes the change instead.
 type DiffResult struct {
-	Available bool
-	Hunks     []DiffHunk
-	Stats     DiffStats
-	Error     string
+	Available bool        `json:"available"`
+	Hunks     []DiffHunk  `json:"hunks,omitempty"`
+	Stats     DiffStats   `json:"stats"`
+	Error     string      `json:"error,omitempty"`
+	Binary    *BinaryDiff `json:"binary,omitempty"`
+}
+
+// Binary diff kinds.
+const (
+	BinaryGeneric = "binary"
+	BinaryImage   = "image"
+	BinaryArchive = "archive"
+	BinaryLarge   = "large" // text, but too large to diff
+)
+
+// BinaryDiff summarizes a change to a file that isn't diffed line by line.
+// Old fields are empty for a created file and new ones for a deleted file.
+type BinaryDiff struct {
+	Kind    string `json:"kind"`
+	OldSize int64  `json:"old_size"`
+	NewSize int64  `json:"new_size"`
+	OldHash string `json:"old_hash,omitempty"` // SHA-256
+	NewHash string `json:"new_hash,omitempty"`
+	OldDims string `json:"old_dims,omitempty"` // images, e.g. "640x480"
+	NewDims string `json:"new_dims,omitempty"`
+
+	// Archive entries added, removed and changed in size or checksum.
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+	Changed []string `json:"changed,omitempty"`
+}
+
+// Unified renders the diff as unified diff text for path, or "" if no diff
+// is available.
+func (d DiffResult) Unified(path string) string {
+	if d.Binary != nil {
+		oldName, newName := "a/"+path, "b/"+path
+		if d.Binary.OldHash == "" {
+			oldName = "/dev/null"
+		}
+		if d.Binary.NewHash == "" {
+			newName = "/dev/null"
+		}
+		return fmt.Sprintf("Binary files %s and %s differ\n", oldName, newName)
+	}
+	if !d.Available {
+		return ""
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- a/%s\n+++ b/%s\n", path, path)
+	for _, hunk := range d.Hunks {
+		b.WriteString(hunk.Header)
+		b.WriteByte('\n')
+		for _, line := range hunk.Lines {
+			switch line.Type {
+			case DiffLineAdd:
+				b.WriteByte('+')
+			case DiffLineDelete:
+				b.WriteByte('-')
+			default:
+				b.WriteByte(' ')
+			}
+			b.WriteString(line.Content)
+			b.WriteByte('\n')
+		}
+	}
+	return b.String()
+}
+
+// Record is a file event enriched with the diff computed for it and the
+// SHA-256 of the file's content before and after (empty when the file did
+// not exist). A record is built once per event and shared by every consumer,
+// so it must be treated as read-only. IDs are assigned by the event store and
+// increase monotonically within a session.
+//
+// Diffs are computed in the background: a record is first published with
+// Pending set, then published again under the same ID once its diff is ready.
+type Record struct {
+	ID         int        `json:"id"`
+	Event      FileEvent  `json:"event"`
+	Pending    bool       `json:"pending,omitempty"`
+	CausedBy   string     `json:"caused_by,omitempty"` // summary of the git operation that made this change
+	BeforeHash string     `json:"before_hash,omitempty"`
+	AfterHash  string     `json:"after_hash,omitempty"`
+	Diff       DiffResult `json:"diff"`
+	// NoOp marks a write that left the content unchanged, such as a
+	// formatter rewriting identical bytes.
+	NoOp bool `json:"no_op,omitempty"`
+	// ChangeSet numbers the burst of events this one belongs to: events
+	// with no quiet gap between them, such as one agent turn. 0 when
+	// grouping is off.
+	ChangeSet int `json:"change_set,omitempty"`
+}
+
+// Alert is a notable condition raised during a session, such as lost events,
+// that should be surfaced alongside the event history.
+type Alert struct {
+	Time    time.Time `json:"time"`
+	Path    string    `json:"path,omitempty"`
+	Message string    `json:"message"`
 }
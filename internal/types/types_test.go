@@ -1,6 +1,7 @@
 package types
 
 import (
+	"encoding/json"
 	"testing"
 	"time"
 )
@@ -66,3 +67,50 @@ func TestFileEventDebounced(t *testing.T) {
 		t.Errorf("expected ChangeCount=1, got %d", single.ChangeCount())
 	}
 }
+
+func TestFileEventJSON(t *testing.T) {
+	ev := FileEvent{
+		Path:      "src/app.go",
+		Op:        OpModify,
+		Timestamp: time.Date(2026, 2, 17, 14, 3, 2, 0, time.UTC),
+	}
+	out, err := json.Marshal(ev)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	want := `{"path":"src/app.go","op":"MODIFY","timestamp":"2026-02-17T14:03:02Z"}`
+	if string(out) != want {
+		t.Errorf("got %s, want %s", out, want)
+	}
+}
+
+func TestOperationUnmarshalText(t *testing.T) {
+	var op Operation
+	if err := op.UnmarshalText([]byte("DELETE")); err != nil || op != OpDelete {
+		t.Errorf("UnmarshalText(DELETE) = %v, %v", op, err)
+	}
+	if err := op.UnmarshalText([]byte("BOGUS")); err == nil {
+		t.Error("expected error for unknown operation")
+	}
+}
+
+func TestDiffResultUnified(t *testing.T) {
+	d := DiffResult{
+		Available: true,
+		Hunks: []DiffHunk{{
+			Header: "@@ -1,2 +1,2 @@",
+			Lines: []DiffLine{
+				{Content: "package main", Type: DiffLineContext},
+				{Content: "var x = 1", Type: DiffLineDelete},
+				{Content: "var x = 2", Type: DiffLineAdd},
+			},
+		}},
+	}
+	want := "--- a/main.go\n+++ b/main.go\n@@ -1,2 +1,2 @@\n package main\n-var x = 1\n+var x = 2\n"
+	if got := d.Unified("main.go"); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got := (DiffResult{}).Unified("main.go"); got != "" {
+		t.Errorf("expected empty patch for unavailable diff, got %q", got)
+	}
+}
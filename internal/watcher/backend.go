@@ -0,0 +1,63 @@
+package watcher
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Backend names accepted in Config.Backend.
+const (
+	BackendNotify = "fsnotify"
+	BackendPoll   = "poll"
+)
+
+// Backend reports raw changes to the directories added to it. Directories
+// are watched non-recursively; the Watcher adds subdirectories itself.
+type Backend interface {
+	Name() string
+	Add(dir string) error
+	Remove(dir string) error
+	Events() <-chan fsnotify.Event
+	Errors() <-chan error
+	Close() error
+}
+
+// notifyBackend uses the OS notification API (inotify, kqueue, ...).
+type notifyBackend struct {
+	fsw *fsnotify.Watcher
+}
+
+func newNotifyBackend() (*notifyBackend, error) {
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	return &notifyBackend{fsw: fsw}, nil
+}
+
+func (b *notifyBackend) Name() string                  { return BackendNotify }
+func (b *notifyBackend) Add(dir string) error          { return b.fsw.Add(dir) }
+func (b *notifyBackend) Remove(dir string) error       { return b.fsw.Remove(dir) }
+func (b *notifyBackend) Events() <-chan fsnotify.Event { return b.fsw.Events }
+func (b *notifyBackend) Errors() <-chan error          { return b.fsw.Errors }
+func (b *notifyBackend) Close() error                  { return b.fsw.Close() }
+
+func newBackend(cfg Config) (Backend, error) {
+	switch cfg.Backend {
+	case "", BackendNotify:
+		return newNotifyBackend()
+	case BackendPoll:
+		return newPoller(cfg.PollInterval, cfg.PollHash), nil
+	default:
+		return nil, fmt.Errorf("unknown watcher backend %q (want %s or %s)", cfg.Backend, BackendNotify, BackendPoll)
+	}
+}
+
+// isWatchLimit reports whether err means the OS ran out of watches (the
+// inotify max_user_watches limit) or file descriptors for them.
+func isWatchLimit(err error) bool {
+	return errors.Is(err, syscall.ENOSPC) || errors.Is(err, syscall.EMFILE)
+}
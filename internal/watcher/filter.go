@@ -1,6 +1,7 @@
 package watcher
 
 import (
+	"fmt"
 	"path/filepath"
 	"strings"
 )
@@ -36,22 +37,87 @@ var defaultFilteredExts = []string{
 	".swn",
 }
 
+// alwaysFilteredDir is never watched: git operations are reported
+// separately, from the git directory itself.
+const alwaysFilteredDir = ".git"
+
+// FilterConfig configures a SmartFilter.
+type FilterConfig struct {
+	// Exclude adds patterns to filter: a glob matched against the file
+	// name, or "name/" for a directory anywhere in the path.
+	Exclude []string
+	// Include, if set, keeps only the files matching one of these globs,
+	// matched against the whole path when they contain a slash (with "**"
+	// for any number of directories, e.g. "src/**/*.go") and against the
+	// file name otherwise.
+	Include []string
+	// Unfilter lifts default filters or Exclude patterns, given as written
+	// in them: "vendor/", "yarn.lock", ".lock" or "*.lock".
+	Unfilter []string
+	// NoDefaults drops the default filters. .git is always filtered.
+	NoDefaults bool
+}
+
 type SmartFilter struct {
 	filteredDirs  []string
 	filteredFiles []string
 	filteredExts  []string
+	tempFiles     bool // editor and agent temp files
 	extraPatterns []string
+	include       []string
 }
 
 func NewSmartFilter(extraPatterns []string) *SmartFilter {
-	return &SmartFilter{
-		filteredDirs:  defaultFilteredDirs,
-		filteredFiles: defaultFilteredFiles,
-		filteredExts:  defaultFilteredExts,
-		extraPatterns: extraPatterns,
+	f, _ := NewFilter(FilterConfig{Exclude: extraPatterns})
+	return f
+}
+
+// NewFilter builds a filter from cfg. It fails if an Unfilter entry lifts
+// nothing.
+func NewFilter(cfg FilterConfig) (*SmartFilter, error) {
+	f := &SmartFilter{
+		filteredDirs:  []string{alwaysFilteredDir},
+		extraPatterns: cfg.Exclude,
+		include:       cfg.Include,
+	}
+	if !cfg.NoDefaults {
+		f.filteredDirs = defaultFilteredDirs
+		f.filteredFiles = defaultFilteredFiles
+		f.filteredExts = defaultFilteredExts
+		f.tempFiles = true
 	}
+	for _, entry := range cfg.Unfilter {
+		found := false
+		if dir := strings.TrimSuffix(entry, "/"); dir != entry && dir != alwaysFilteredDir {
+			f.filteredDirs = without(f.filteredDirs, dir, &found)
+		}
+		f.filteredFiles = without(f.filteredFiles, entry, &found)
+		f.filteredExts = without(f.filteredExts, strings.TrimPrefix(entry, "*"), &found)
+		f.extraPatterns = without(f.extraPatterns, entry, &found)
+		if !found {
+			return nil, fmt.Errorf("unfilter %q matches no filter", entry)
+		}
+	}
+	return f, nil
 }
 
+// without returns list less any entries equal to s, setting *found if
+// there were some. list is copied rather than modified.
+func without(list []string, s string, found *bool) []string {
+	var out []string
+	for _, e := range list {
+		if e == s {
+			*found = true
+			continue
+		}
+		out = append(out, e)
+	}
+	return out
+}
+
+// IsFiltered reports whether path, relative to the watched directory, is
+// left out. A trailing slash marks a directory, which with Include patterns
+// is kept as long as something in it could be included.
 func (f *SmartFilter) IsFiltered(path string) bool {
 	parts := strings.Split(filepath.ToSlash(path), "/")
 
@@ -80,14 +146,16 @@ func (f *SmartFilter) IsFiltered(path string) bool {
 		}
 	}
 
-	// Filter vim/editor temp files (~ suffix, 4913)
-	if strings.HasSuffix(base, "~") || base == "4913" {
-		return true
-	}
+	if f.tempFiles {
+		// Filter vim/editor temp files (~ suffix, 4913)
+		if strings.HasSuffix(base, "~") || base == "4913" {
+			return true
+		}
 
-	// Filter agent temp files (e.g. TECH_DOC.md.tmp.1482378.1771433725085)
-	if strings.Contains(base, ".tmp.") {
-		return true
+		// Filter agent temp files (e.g. TECH_DOC.md.tmp.1482378.1771433725085)
+		if strings.Contains(base, ".tmp.") {
+			return true
+		}
 	}
 
 	// Check extra patterns
@@ -108,5 +176,87 @@ func (f *SmartFilter) IsFiltered(path string) bool {
 		}
 	}
 
+	slashed := filepath.ToSlash(path)
+	if dir := strings.TrimSuffix(slashed, "/"); dir != slashed {
+		return !f.mayInclude(dir)
+	}
+	return !f.included(slashed)
+}
+
+// included reports whether the file at path matches an Include pattern.
+func (f *SmartFilter) included(path string) bool {
+	if len(f.include) == 0 {
+		return true
+	}
+	for _, pattern := range f.include {
+		if !strings.Contains(pattern, "/") {
+			if matched, _ := filepath.Match(pattern, filepath.Base(path)); matched {
+				return true
+			}
+			continue
+		}
+		if matchPath(strings.Split(pattern, "/"), strings.Split(path, "/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// mayInclude reports whether an Include pattern could match a file below
+// dir.
+func (f *SmartFilter) mayInclude(dir string) bool {
+	if len(f.include) == 0 || dir == "." || dir == "" {
+		return true
+	}
+	parts := strings.Split(dir, "/")
+	for _, pattern := range f.include {
+		if !strings.Contains(pattern, "/") {
+			return true // matches file names at any depth
+		}
+		segs := strings.Split(pattern, "/")
+		if matchPrefix(segs[:len(segs)-1], parts) {
+			return true
+		}
+	}
 	return false
 }
+
+// matchPath matches path segments against glob segments, where "**"
+// matches any number of segments.
+func matchPath(pattern, path []string) bool {
+	if len(pattern) == 0 {
+		return len(path) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(path); i++ {
+			if matchPath(pattern[1:], path[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(path) == 0 {
+		return false
+	}
+	if matched, _ := filepath.Match(pattern[0], path[0]); !matched {
+		return false
+	}
+	return matchPath(pattern[1:], path[1:])
+}
+
+// matchPrefix reports whether the directory path could lead to a match for
+// the directory segments of a pattern.
+func matchPrefix(pattern, path []string) bool {
+	for i, part := range path {
+		if i >= len(pattern) {
+			return false
+		}
+		if pattern[i] == "**" {
+			return true
+		}
+		if matched, _ := filepath.Match(pattern[i], part); !matched {
+			return false
+		}
+	}
+	return true
+}
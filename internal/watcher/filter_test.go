@@ -61,3 +61,74 @@ func TestSmartFilterWithExtra(t *testing.T) {
 		t.Error("expected src/main.go to NOT be filtered")
 	}
 }
+
+func TestSmartFilterInclude(t *testing.T) {
+	f, _ := NewFilter(FilterConfig{Include: []string{"src/**/*.go", "*.md"}})
+
+	tests := []struct {
+		path     string
+		filtered bool
+	}{
+		{"src/main.go", false},
+		{"src/pkg/deep/util.go", false},
+		{"README.md", false},
+		{"docs/guide.md", false},
+		{"src/main_test.py", true},
+		{"main.go", true},
+		{"src/", false},
+		{"src/pkg/", false},
+		// Still reached for *.md
+		{"docs/", false},
+		// Defaults still apply
+		{"src/vendor/lib.go", true},
+	}
+	for _, tt := range tests {
+		if got := f.IsFiltered(tt.path); got != tt.filtered {
+			t.Errorf("IsFiltered(%q) = %v, want %v", tt.path, got, tt.filtered)
+		}
+	}
+
+	f, _ = NewFilter(FilterConfig{Include: []string{"src/**/*.go"}})
+	if !f.IsFiltered("docs/") {
+		t.Error("expected docs/ to be skipped when nothing in it can be included")
+	}
+}
+
+func TestSmartFilterUnfilter(t *testing.T) {
+	f, err := NewFilter(FilterConfig{
+		Exclude:  []string{"generated/", "*.log"},
+		Unfilter: []string{"vendor/", "*.lock", "yarn.lock", "generated/"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"vendor/lib/thing.go", "Cargo.lock", "yarn.lock", "generated/api.go"} {
+		if f.IsFiltered(path) {
+			t.Errorf("expected %s to be unfiltered", path)
+		}
+	}
+	for _, path := range []string{"node_modules/x.js", "debug.log", "package-lock.json"} {
+		if !f.IsFiltered(path) {
+			t.Errorf("expected %s to stay filtered", path)
+		}
+	}
+
+	if _, err := NewFilter(FilterConfig{Unfilter: []string{"nothing/"}}); err == nil {
+		t.Error("expected an error for an entry that lifts nothing")
+	}
+	if _, err := NewFilter(FilterConfig{Unfilter: []string{".git/"}}); err == nil {
+		t.Error("expected .git to stay filtered")
+	}
+}
+
+func TestSmartFilterNoDefaults(t *testing.T) {
+	f, _ := NewFilter(FilterConfig{NoDefaults: true})
+	for _, path := range []string{"node_modules/x.js", "build/out.js", "yarn.lock", "main.go~"} {
+		if f.IsFiltered(path) {
+			t.Errorf("expected %s not to be filtered", path)
+		}
+	}
+	if !f.IsFiltered(".git/config") {
+		t.Error("expected .git to be filtered regardless")
+	}
+}
@@ -0,0 +1,88 @@
+package watcher
+
+import (
+	"fmt"
+	"io/fs"
+	"os/user"
+	"strconv"
+
+	"github.com/wgawan/agent-spy/internal/types"
+)
+
+func (s fileState) isLink() bool {
+	return s.mode&fs.ModeSymlink != 0
+}
+
+// sameContent reports whether s and other look like the same content, so
+// that any difference between them is metadata only.
+func (s fileState) sameContent(other fileState) bool {
+	return s.size == other.size && s.mtime.Equal(other.mtime) && s.inode == other.inode && s.sum == other.sum
+}
+
+// metaChange describes how the metadata of old differs from cur, or returns
+// nil if it doesn't.
+func metaChange(old, cur fileState) *types.MetaChange {
+	var m types.MetaChange
+	changed := false
+	if old.mode != cur.mode {
+		m.OldMode, m.NewMode = old.mode.String(), cur.mode.String()
+		changed = true
+	}
+	if old.uid != cur.uid || old.gid != cur.gid {
+		m.OldOwner, m.NewOwner = ownerName(old.uid, old.gid), ownerName(cur.uid, cur.gid)
+		changed = true
+	}
+	if old.target != cur.target {
+		m.OldTarget, m.NewTarget = old.target, cur.target
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	return &m
+}
+
+// mergeMeta combines metadata changes made one after the other: each field
+// goes from its first old value to its last new value.
+func mergeMeta(a, b *types.MetaChange) *types.MetaChange {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	m := *a
+	if b.NewMode != "" {
+		if m.OldMode == "" {
+			m.OldMode = b.OldMode
+		}
+		m.NewMode = b.NewMode
+	}
+	if b.NewOwner != "" {
+		if m.OldOwner == "" {
+			m.OldOwner = b.OldOwner
+		}
+		m.NewOwner = b.NewOwner
+	}
+	if b.OldTarget != "" || b.NewTarget != "" {
+		if m.OldTarget == "" && m.NewTarget == "" {
+			m.OldTarget = b.OldTarget
+		}
+		m.NewTarget = b.NewTarget
+	}
+	return &m
+}
+
+// ownerName formats a user and group as "name:group", falling back to the
+// numeric IDs when they can't be looked up.
+func ownerName(uid, gid uint32) string {
+	u := strconv.FormatUint(uint64(uid), 10)
+	g := strconv.FormatUint(uint64(gid), 10)
+	if found, err := user.LookupId(u); err == nil {
+		u = found.Username
+	}
+	if found, err := user.LookupGroupId(g); err == nil {
+		g = found.Name
+	}
+	return fmt.Sprintf("%s:%s", u, g)
+}
@@ -0,0 +1,236 @@
+package watcher
+
+import (
+	"hash/fnv"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// DefaultPollInterval is how often the poll backend scans by default.
+const DefaultPollInterval = time.Second
+
+// poller is a Backend that finds changes by periodically listing watched
+// directories and comparing each entry's size, mtime, inode, mode, owner and
+// symlink target, and optionally a hash of its content. It works wherever
+// stat does, including network mounts and FUSE filesystems where inotify
+// sees nothing. Changes to metadata alone are reported as Chmod.
+type poller struct {
+	interval time.Duration
+	hash     bool
+	events   chan fsnotify.Event
+	errors   chan error
+	done     chan struct{}
+
+	mu   sync.Mutex
+	dirs map[string]map[string]fileState // watched dir → entry name → state
+}
+
+type fileState struct {
+	size   int64
+	mtime  time.Time
+	inode  uint64
+	mode   os.FileMode
+	uid    uint32
+	gid    uint32
+	target string // symlink target
+	sum    uint64 // content hash, when hashing
+}
+
+func newPoller(interval time.Duration, hash bool) *poller {
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	p := &poller{
+		interval: interval,
+		hash:     hash,
+		events:   make(chan fsnotify.Event, 100),
+		errors:   make(chan error, 10),
+		done:     make(chan struct{}),
+		dirs:     make(map[string]map[string]fileState),
+	}
+	go p.run()
+	return p
+}
+
+func (p *poller) Name() string                  { return BackendPoll }
+func (p *poller) Events() <-chan fsnotify.Event { return p.events }
+func (p *poller) Errors() <-chan error          { return p.errors }
+
+// Add starts polling dir. Its current entries are the baseline; only later
+// changes are reported.
+func (p *poller) Add(dir string) error {
+	entries, err := p.scan(dir)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.dirs[dir] = entries
+	return nil
+}
+
+func (p *poller) Remove(dir string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.dirs, dir)
+	return nil
+}
+
+func (p *poller) Close() error {
+	close(p.done)
+	return nil
+}
+
+func (p *poller) run() {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			events, errs := p.poll()
+			for _, err := range errs {
+				select {
+				case p.errors <- err:
+				default: // nobody is draining errors; don't stall polling
+				}
+			}
+			for _, ev := range events {
+				select {
+				case p.events <- ev:
+				case <-p.done:
+					return
+				}
+			}
+		case <-p.done:
+			return
+		}
+	}
+}
+
+// poll rescans every watched directory and returns the changes since the
+// last scan. Events are sent after the lock is released, since the consumer
+// calls Add when it sees a new directory.
+func (p *poller) poll() ([]fsnotify.Event, []error) {
+	p.mu.Lock()
+	dirs := make([]string, 0, len(p.dirs))
+	for dir := range p.dirs {
+		dirs = append(dirs, dir)
+	}
+	p.mu.Unlock()
+	sort.Strings(dirs)
+
+	var events []fsnotify.Event
+	var errs []error
+	for _, dir := range dirs {
+		cur, err := p.scan(dir)
+
+		p.mu.Lock()
+		old, watched := p.dirs[dir]
+		switch {
+		case !watched:
+			// Dropped while scanning
+		case os.IsNotExist(err):
+			// The directory went away; so did everything in it.
+			for _, name := range sortedNames(old) {
+				events = append(events, fsnotify.Event{Name: filepath.Join(dir, name), Op: fsnotify.Remove})
+			}
+			delete(p.dirs, dir)
+		case err != nil:
+			// Report it once rather than on every poll.
+			errs = append(errs, err)
+			delete(p.dirs, dir)
+		default:
+			events = append(events, diffEntries(dir, old, cur)...)
+			p.dirs[dir] = cur
+		}
+		p.mu.Unlock()
+	}
+	return events, errs
+}
+
+// diffEntries compares two listings of dir. Directories are only reported
+// when they appear or disappear; their mtime changes with every entry.
+func diffEntries(dir string, old, cur map[string]fileState) []fsnotify.Event {
+	var events []fsnotify.Event
+	for _, name := range sortedNames(cur) {
+		s := cur[name]
+		prev, existed := old[name]
+		switch {
+		case !existed:
+			events = append(events, fsnotify.Event{Name: filepath.Join(dir, name), Op: fsnotify.Create})
+		case s.mode.IsDir() && prev.mode.IsDir():
+		case s != prev && s.sameContent(prev):
+			events = append(events, fsnotify.Event{Name: filepath.Join(dir, name), Op: fsnotify.Chmod})
+		case s != prev:
+			events = append(events, fsnotify.Event{Name: filepath.Join(dir, name), Op: fsnotify.Write})
+		}
+	}
+	for _, name := range sortedNames(old) {
+		if _, ok := cur[name]; !ok {
+			events = append(events, fsnotify.Event{Name: filepath.Join(dir, name), Op: fsnotify.Remove})
+		}
+	}
+	return events
+}
+
+func (p *poller) scan(dir string) (map[string]fileState, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	states := make(map[string]fileState, len(entries))
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil {
+			continue // removed since ReadDir
+		}
+		s := stateOf(filepath.Join(dir, e.Name()), info)
+		if p.hash && info.Mode().IsRegular() {
+			s.sum = hashFile(filepath.Join(dir, e.Name()))
+		}
+		states[e.Name()] = s
+	}
+	return states, nil
+}
+
+// stateOf returns the state of the file at path, as described by info from
+// Lstat.
+func stateOf(path string, info os.FileInfo) fileState {
+	s := fileState{
+		size:  info.Size(),
+		mtime: info.ModTime(),
+		inode: inode(info),
+		mode:  info.Mode(),
+	}
+	s.uid, s.gid = owner(info)
+	if s.isLink() {
+		s.target, _ = os.Readlink(path)
+	}
+	return s
+}
+
+func hashFile(path string) uint64 {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	h := fnv.New64a()
+	io.Copy(h, f)
+	return h.Sum64()
+}
+
+func sortedNames(m map[string]fileState) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
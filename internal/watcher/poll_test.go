@@ -0,0 +1,148 @@
+package watcher
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/wgawan/agent-spy/internal/types"
+)
+
+func newPollWatcher(t *testing.T, dir string, hash bool) chan types.FileEvent {
+	t.Helper()
+	events := make(chan types.FileEvent, 10)
+	w, err := New(Config{
+		Path:         dir,
+		EventsChan:   events,
+		Debounce:     100 * time.Millisecond, // spans several polls, so a write seen half-done merges
+		Backend:      BackendPoll,
+		PollInterval: 20 * time.Millisecond,
+		PollHash:     hash,
+	})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	t.Cleanup(w.Close)
+	if w.Backend() != BackendPoll {
+		t.Fatalf("expected poll backend, got %s", w.Backend())
+	}
+	go w.Start()
+	return events
+}
+
+func expectEvent(t *testing.T, events chan types.FileEvent, path string, op types.Operation) {
+	t.Helper()
+	select {
+	case ev := <-events:
+		if ev.Path != path || ev.Op != op {
+			t.Errorf("expected %v %s, got %v %s", op, path, ev.Op, ev.Path)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("timeout waiting for %v %s", op, path)
+	}
+}
+
+func TestPollBackend(t *testing.T) {
+	dir := t.TempDir()
+	events := newPollWatcher(t, dir, false)
+
+	file := filepath.Join(dir, "main.go")
+	os.WriteFile(file, []byte("package main\n"), 0644)
+	expectEvent(t, events, "main.go", types.OpCreate)
+
+	os.WriteFile(file, []byte("package main\n\nfunc main() {}\n"), 0644)
+	expectEvent(t, events, "main.go", types.OpModify)
+
+	os.Mkdir(filepath.Join(dir, "pkg"), 0755)
+	time.Sleep(100 * time.Millisecond) // let the new directory be added
+	os.WriteFile(filepath.Join(dir, "pkg", "util.go"), []byte("package pkg\n"), 0644)
+	expectEvent(t, events, filepath.Join("pkg", "util.go"), types.OpCreate)
+
+	os.Remove(file)
+	expectEvent(t, events, "main.go", types.OpDelete)
+}
+
+func TestPollBackendHashCatchesSameStatWrites(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "a.txt")
+	os.WriteFile(file, []byte("aaaa"), 0644)
+	mtime := time.Now().Add(-time.Hour)
+	os.Chtimes(file, mtime, mtime)
+
+	events := newPollWatcher(t, dir, true)
+	time.Sleep(50 * time.Millisecond)
+
+	// Same size, same mtime, same inode: only the content differs.
+	f, _ := os.OpenFile(file, os.O_WRONLY, 0)
+	f.WriteString("bbbb")
+	f.Close()
+	os.Chtimes(file, mtime, mtime)
+
+	expectEvent(t, events, "a.txt", types.OpModify)
+}
+
+// limitedBackend fails to add directories once full, as inotify does when
+// max_user_watches is reached.
+type limitedBackend struct {
+	Backend
+	full atomic.Bool
+}
+
+func (b *limitedBackend) Add(dir string) error {
+	if b.full.Load() {
+		return &os.PathError{Op: "add", Path: dir, Err: syscall.ENOSPC}
+	}
+	return b.Backend.Add(dir)
+}
+
+func TestWatcherPollsDirectoriesPastWatchLimit(t *testing.T) {
+	dir := t.TempDir()
+	events := make(chan types.FileEvent, 10)
+	var alerts []string
+	var mu sync.Mutex
+	w, err := New(Config{
+		Path:         dir,
+		EventsChan:   events,
+		Debounce:     100 * time.Millisecond,
+		PollInterval: 20 * time.Millisecond,
+		OnAlert: func(a types.Alert) {
+			mu.Lock()
+			alerts = append(alerts, a.Message)
+			mu.Unlock()
+		},
+	})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	defer w.Close()
+	limited := &limitedBackend{Backend: w.backend}
+	limited.full.Store(true)
+	w.backend = limited
+	go w.Start()
+	time.Sleep(50 * time.Millisecond)
+
+	os.Mkdir(filepath.Join(dir, "pkg"), 0755)
+	time.Sleep(200 * time.Millisecond) // let the new directory be added
+	os.WriteFile(filepath.Join(dir, "pkg", "util.go"), []byte("package pkg\n"), 0644)
+	expectEvent(t, events, filepath.Join("pkg", "util.go"), types.OpCreate)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(alerts) != 1 || !strings.Contains(alerts[0], "polling new directories") {
+		t.Errorf("expected one alert about polling, got %q", alerts)
+	}
+}
+
+func TestIsWatchLimit(t *testing.T) {
+	if !isWatchLimit(&os.PathError{Op: "add", Path: "/x", Err: syscall.ENOSPC}) {
+		t.Error("expected ENOSPC to be a watch limit")
+	}
+	if isWatchLimit(os.ErrPermission) {
+		t.Error("expected permission errors not to be a watch limit")
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !unix
+
+package watcher
+
+import "os"
+
+func inode(info os.FileInfo) uint64 {
+	return 0
+}
+
+func owner(info os.FileInfo) (uid, gid uint32) {
+	return 0, 0
+}
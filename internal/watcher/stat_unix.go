@@ -0,0 +1,25 @@
+//go:build unix
+
+package watcher
+
+import (
+	"os"
+	"syscall"
+)
+
+// inode returns the file's inode number, so a file replaced by a rename is
+// noticed even when its size and mtime match.
+func inode(info os.FileInfo) uint64 {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(st.Ino)
+	}
+	return 0
+}
+
+// owner returns the file's user and group IDs.
+func owner(info os.FileInfo) (uid, gid uint32) {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return st.Uid, st.Gid
+	}
+	return 0, 0
+}
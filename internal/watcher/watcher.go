@@ -1,9 +1,14 @@
 package watcher
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
@@ -12,78 +17,290 @@ import (
 
 type Config struct {
 	Path       string
+	Root       string // label for events when several roots are watched
 	EventsChan chan types.FileEvent
 	Debounce   time.Duration
 	Filters    []string // glob patterns to exclude
+
+	// Include, Unfilter and NoDefaultFilters adjust the filter as described
+	// in FilterConfig.
+	Include          []string
+	Unfilter         []string
+	NoDefaultFilters bool
+
+	// FollowSymlinks watches the directories that symlinks point to as if
+	// they were inside the tree. Targets already in the tree, or containing
+	// it, are not followed, so symlink loops are harmless.
+	FollowSymlinks bool
+
+	// Backend is BackendNotify or BackendPoll. Left empty, fsnotify is used
+	// and polling takes over if the OS runs out of watches.
+	Backend      string
+	PollInterval time.Duration // default DefaultPollInterval
+	PollHash     bool          // also compare content hashes when polling
+
+	// OnAlert is called when events may have been lost, such as when the
+	// event queue overflows, and with the outcome of the rescan that
+	// follows. May be nil.
+	OnAlert func(types.Alert)
 }
 
 type Watcher struct {
 	config  Config
-	fsw     *fsnotify.Watcher
+	backend Backend
 	filter  *SmartFilter
 	pending map[string]*pendingEvent
 	mu      sync.Mutex
 	done    chan struct{}
+
+	// fallback polls the directories added once the OS ran out of watches
+	// after startup. It is nil unless fsnotify was chosen automatically.
+	fallback     *poller
+	fallbackUsed atomic.Bool
+
+	// While paused, events are held by path, in the order the paths first
+	// changed, instead of being sent. Both are guarded by mu.
+	paused bool
+	held   map[string][]types.FileEvent
+	order  []string
+
+	// index is the last known state of every watched file, by relative
+	// path. A rescan compares the tree against it to find missed changes.
+	// dirs holds the watched directories the same way, and expanded the
+	// paths already reported as part of a removed directory. links maps
+	// the real path of the tree and of each followed symlink target to the
+	// relative path it is watched under. removedLinks keeps deleted
+	// symlinks, so one recreated pointing elsewhere is seen as repointed.
+	index        map[string]fileState
+	dirs         map[string]bool
+	expanded     map[string]bool
+	links        map[string]string
+	removedLinks map[string]fileState
+	indexMu      sync.Mutex
+	rescanning   atomic.Bool
+}
+
+// tree is the result of scanning the watched directory.
+type tree struct {
+	files map[string]fileState
+	dirs  map[string]bool
+	links map[string]string
 }
 
 type pendingEvent struct {
-	events []types.FileEvent
-	timer  *time.Timer
+	events   []types.FileEvent
+	children []types.FileEvent // files of a removed directory, sent first
+	timer    *time.Timer
 }
 
 func New(cfg Config) (*Watcher, error) {
-	fsw, err := fsnotify.NewWatcher()
+	if cfg.Debounce == 0 {
+		cfg.Debounce = 500 * time.Millisecond
+	}
+
+	filter, err := NewFilter(FilterConfig{
+		Exclude:    cfg.Filters,
+		Include:    cfg.Include,
+		Unfilter:   cfg.Unfilter,
+		NoDefaults: cfg.NoDefaultFilters,
+	})
 	if err != nil {
 		return nil, err
 	}
-
-	if cfg.Debounce == 0 {
-		cfg.Debounce = 500 * time.Millisecond
+	backend, err := newBackend(cfg)
+	if err != nil {
+		return nil, err
 	}
 
 	w := &Watcher{
-		config:  cfg,
-		fsw:     fsw,
-		filter:  NewSmartFilter(cfg.Filters),
-		pending: make(map[string]*pendingEvent),
-		done:    make(chan struct{}),
+		config:       cfg,
+		backend:      backend,
+		filter:       filter,
+		pending:      make(map[string]*pendingEvent),
+		done:         make(chan struct{}),
+		index:        make(map[string]fileState),
+		dirs:         make(map[string]bool),
+		expanded:     make(map[string]bool),
+		links:        make(map[string]string),
+		removedLinks: make(map[string]fileState),
+	}
+
+	err = w.addTree()
+	if err != nil && cfg.Backend == "" && isWatchLimit(err) {
+		// Too many directories for inotify; polling has no such limit.
+		backend.Close()
+		w.backend = newPoller(cfg.PollInterval, cfg.PollHash)
+		err = w.addTree()
+	}
+	if err != nil {
+		w.backend.Close()
+		return nil, err
+	}
+	if cfg.Backend == "" && w.backend.Name() == BackendNotify {
+		w.fallback = newPoller(cfg.PollInterval, cfg.PollHash)
+	}
+
+	return w, nil
+}
+
+// Files returns the regular files being watched, relative to the watched
+// path and sorted.
+func (w *Watcher) Files() []string {
+	w.indexMu.Lock()
+	defer w.indexMu.Unlock()
+	files := make([]string, 0, len(w.index))
+	for path, st := range w.index {
+		if st.mode.IsRegular() {
+			files = append(files, path)
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+// addTree adds the watched directory and all unfiltered subdirectories to
+// the backend and indexes the files in them.
+func (w *Watcher) addTree() error {
+	t, err := w.scan(w.backend.Add)
+	if err != nil {
+		return err
 	}
+	w.indexMu.Lock()
+	w.index, w.dirs, w.links = t.files, t.dirs, t.links
+	w.indexMu.Unlock()
+	return nil
+}
 
-	// Walk directory and add all subdirectories
-	err = filepath.Walk(cfg.Path, func(path string, info os.FileInfo, err error) error {
+// scan walks the tree, calling addDir for each unfiltered directory, and
+// returns the state of every unfiltered file, the set of directories and
+// the symlinks followed.
+func (w *Watcher) scan(addDir func(string) error) (tree, error) {
+	t := tree{
+		files: make(map[string]fileState),
+		dirs:  make(map[string]bool),
+		links: make(map[string]string),
+	}
+	info, err := os.Stat(w.config.Path)
+	if err != nil {
+		return t, err
+	}
+	if real, err := filepath.EvalSymlinks(w.config.Path); err == nil {
+		t.links[real] = "."
+	}
+	err = w.walk(w.config.Path, info, t.links, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return nil // skip errors
 		}
+		relPath, relErr := filepath.Rel(w.config.Path, path)
+		if relErr != nil {
+			return nil
+		}
 		if info.IsDir() {
 			// Skip filtered directories
-			relPath, relErr := filepath.Rel(cfg.Path, path)
-			if relErr == nil && w.filter.IsFiltered(relPath+"/") {
+			if w.filter.IsFiltered(relPath + "/") {
 				return filepath.SkipDir
 			}
-			return fsw.Add(path)
+			t.dirs[relPath] = true
+			return addDir(path)
+		}
+		if !w.isFiltered(relPath) {
+			t.files[relPath] = stateOf(path, info)
 		}
 		return nil
 	})
+	return t, err
+}
+
+// walk calls fn for path and everything below it, like filepath.Walk, with
+// info describing path. With FollowSymlinks, a symlink to a directory is
+// walked as a directory unless its target overlaps one in links, which it
+// is then added to.
+func (w *Watcher) walk(path string, info os.FileInfo, links map[string]string, fn filepath.WalkFunc) error {
+	if info.Mode()&os.ModeSymlink != 0 && w.config.FollowSymlinks {
+		if target, ok := w.follow(path, links); ok {
+			info = target
+		}
+	}
+	if err := fn(path, info, nil); err != nil || !info.IsDir() {
+		if err == filepath.SkipDir {
+			return nil
+		}
+		return err
+	}
+	entries, err := os.ReadDir(path)
 	if err != nil {
-		fsw.Close()
-		return nil, err
+		return nil // removed since, or unreadable
 	}
+	for _, e := range entries {
+		child, err := e.Info()
+		if err != nil {
+			continue
+		}
+		if err := w.walk(filepath.Join(path, e.Name()), child, links, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	return w, nil
+// follow returns the directory the symlink at path points to, if it should
+// be walked, and records it in links. A target inside a directory already
+// in links, or containing one, would be walked twice or forever.
+func (w *Watcher) follow(path string, links map[string]string) (os.FileInfo, bool) {
+	info, err := os.Stat(path)
+	if err != nil || !info.IsDir() {
+		return nil, false
+	}
+	real, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return nil, false
+	}
+	for seen := range links {
+		if within(real, seen) || within(seen, real) {
+			return nil, false
+		}
+	}
+	relPath, err := filepath.Rel(w.config.Path, path)
+	if err != nil {
+		return nil, false
+	}
+	links[real] = relPath
+	return info, true
+}
+
+// within reports whether path is dir or inside it.
+func within(path, dir string) bool {
+	return path == dir || strings.HasPrefix(path, dir+string(filepath.Separator))
+}
+
+// Backend returns the name of the backend in use, which is BackendPoll if
+// the watcher fell back to polling at startup.
+func (w *Watcher) Backend() string {
+	return w.backend.Name()
 }
 
 func (w *Watcher) Start() {
+	var fallbackEvents <-chan fsnotify.Event
+	var fallbackErrors <-chan error
+	if w.fallback != nil {
+		fallbackEvents, fallbackErrors = w.fallback.Events(), w.fallback.Errors()
+	}
 	for {
 		select {
-		case event, ok := <-w.fsw.Events:
+		case event, ok := <-w.backend.Events():
 			if !ok {
 				return
 			}
 			w.handleEvent(event)
-		case _, ok := <-w.fsw.Errors:
+		case err, ok := <-w.backend.Errors():
 			if !ok {
 				return
 			}
+			w.handleError(err)
+		case event := <-fallbackEvents:
+			w.handleEvent(event)
+		case err := <-fallbackErrors:
+			w.handleError(err)
 		case <-w.done:
 			return
 		}
@@ -92,7 +309,34 @@ func (w *Watcher) Start() {
 
 func (w *Watcher) Close() {
 	close(w.done)
-	w.fsw.Close()
+	w.backend.Close()
+	if w.fallback != nil {
+		w.fallback.Close()
+	}
+}
+
+// addDir watches a directory found after startup. If the OS has run out of
+// watches, it is polled instead, along with any added after it.
+func (w *Watcher) addDir(dir string) error {
+	err := w.backend.Add(dir)
+	if err == nil || w.fallback == nil || !isWatchLimit(err) {
+		return err
+	}
+	if err := w.fallback.Add(dir); err != nil {
+		return err
+	}
+	if !w.fallbackUsed.Swap(true) {
+		w.alert(dir, "out of watches ("+err.Error()+"); polling new directories")
+	}
+	return nil
+}
+
+// unwatchDir stops watching a directory, whichever backend has it.
+func (w *Watcher) unwatchDir(dir string) {
+	w.backend.Remove(dir)
+	if w.fallback != nil {
+		w.fallback.Remove(dir)
+	}
 }
 
 func (w *Watcher) handleEvent(event fsnotify.Event) {
@@ -101,18 +345,31 @@ func (w *Watcher) handleEvent(event fsnotify.Event) {
 		return
 	}
 
+	// Make path relative
+	relPath, err := filepath.Rel(w.config.Path, event.Name)
+	if err != nil {
+		relPath = event.Name
+	}
+
 	// Check if this is a new directory being created
 	if event.Op.Has(fsnotify.Create) {
-		if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
-			w.fsw.Add(event.Name)
+		if info, err := os.Lstat(event.Name); err == nil && (info.IsDir() || w.isDirLink(event.Name, info)) {
+			w.addNewDir(event.Name, info)
 			return // Don't emit events for directory creation
 		}
 	}
 
-	// Make path relative
-	relPath, err := filepath.Rel(w.config.Path, event.Name)
-	if err != nil {
-		relPath = event.Name
+	if op == types.OpDelete || op == types.OpRename {
+		if w.removeDir(relPath, op) {
+			return
+		}
+		w.indexMu.Lock()
+		already := w.expanded[relPath]
+		delete(w.expanded, relPath)
+		w.indexMu.Unlock()
+		if already {
+			return // reported with its directory
+		}
 	}
 
 	// Skip filtered paths
@@ -120,29 +377,298 @@ func (w *Watcher) handleEvent(event fsnotify.Event) {
 		return
 	}
 
+	var meta *types.MetaChange
+	w.indexMu.Lock()
+	old, indexed := w.index[relPath]
+	known := indexed
+	if !indexed {
+		old, known = w.removedLinks[relPath]
+	}
+	if info, err := os.Lstat(event.Name); err == nil && !info.IsDir() {
+		s := stateOf(event.Name, info)
+		if op == types.OpCreate && indexed && old == s {
+			w.indexMu.Unlock()
+			return // already reported by addNewDir
+		}
+		w.index[relPath] = s
+		delete(w.removedLinks, relPath)
+		if known {
+			meta = metaChange(old, s)
+		}
+		switch {
+		case op == types.OpMeta && meta == nil:
+			w.indexMu.Unlock()
+			return // only timestamps changed, as with touch
+		case old.isLink() && s.isLink() && meta != nil:
+			op = types.OpMeta // a symlink repointed by replacing it
+		}
+	} else {
+		if indexed && old.isLink() {
+			w.removedLinks[relPath] = old
+		}
+		delete(w.index, relPath)
+		if op == types.OpMeta {
+			w.indexMu.Unlock()
+			return // gone, or a directory
+		}
+	}
+	w.indexMu.Unlock()
+
+	fe := w.event(relPath, op)
+	fe.Meta = meta
+	w.debounce(fe)
+}
+
+// isDirLink reports whether info, from Lstat, is a symlink to a directory
+// that FollowSymlinks asks to watch.
+func (w *Watcher) isDirLink(path string, info os.FileInfo) bool {
+	if !w.config.FollowSymlinks || info.Mode()&os.ModeSymlink == 0 {
+		return false
+	}
+	target, err := os.Stat(path)
+	return err == nil && target.IsDir()
+}
+
+// addNewDir watches a directory that just appeared, with its subdirectories,
+// and reports the files already inside. An agent running `mkdir -p a/b` and
+// writing a/b/c.go often finishes before the watch is attached, and the
+// file would otherwise never be seen. Files that also get a create event of
+// their own are reported once. info is path's Lstat; a symlink that isn't
+// followed after all is reported as a file.
+func (w *Watcher) addNewDir(path string, info os.FileInfo) {
+	w.indexMu.Lock()
+	links := make(map[string]string, len(w.links))
+	for real, relPath := range w.links {
+		links[real] = relPath
+	}
+	w.indexMu.Unlock()
+
+	w.walk(path, info, links, func(p string, info os.FileInfo, err error) error {
+		relPath, err := filepath.Rel(w.config.Path, p)
+		if err != nil {
+			return nil
+		}
+		if info.IsDir() {
+			if w.filter.IsFiltered(relPath + "/") {
+				return filepath.SkipDir
+			}
+			if err := w.addDir(p); err != nil {
+				w.alert(p, "not watching new directory: "+err.Error())
+				return filepath.SkipDir
+			}
+			w.indexMu.Lock()
+			w.dirs[relPath] = true
+			w.indexMu.Unlock()
+			return nil
+		}
+		if w.isFiltered(relPath) {
+			return nil
+		}
+		w.indexMu.Lock()
+		_, known := w.index[relPath]
+		if !known {
+			w.index[relPath] = stateOf(p, info)
+			delete(w.expanded, relPath)
+		}
+		w.indexMu.Unlock()
+		if !known {
+			w.debounce(w.event(relPath, types.OpCreate))
+		}
+		return nil
+	})
+
+	w.indexMu.Lock()
+	for real, relPath := range links {
+		w.links[real] = relPath
+	}
+	w.indexMu.Unlock()
+}
+
+// removeDir handles the removal or move of a watched directory, which
+// fsnotify reports as a single event. Every file known to be inside gets an
+// event of its own, sent just before one for the directory. Watches on the
+// directory and its subdirectories are dropped. It reports false if relPath
+// isn't a watched directory.
+func (w *Watcher) removeDir(relPath string, op types.Operation) bool {
+	prefix := relPath + string(filepath.Separator)
+
+	w.indexMu.Lock()
+	if !w.dirs[relPath] {
+		w.indexMu.Unlock()
+		return false
+	}
+	var files, gone []string
+	for p := range w.index {
+		if strings.HasPrefix(p, prefix) {
+			files = append(files, p)
+			delete(w.index, p)
+			w.expanded[p] = true
+		}
+	}
+	for real, d := range w.links {
+		if d == relPath || strings.HasPrefix(d, prefix) {
+			delete(w.links, real)
+		}
+	}
+	for d := range w.dirs {
+		if d == relPath || strings.HasPrefix(d, prefix) {
+			gone = append(gone, d)
+			delete(w.dirs, d)
+			if d != relPath {
+				w.expanded[d] = true
+			}
+		}
+	}
+	w.indexMu.Unlock()
+
+	for _, d := range gone {
+		w.unwatchDir(filepath.Join(w.config.Path, d))
+	}
+
+	dir := w.event(relPath, op)
+	dir.IsDir = true
+	byPath := make(map[string]types.FileEvent)
+	for _, f := range files {
+		fe := w.event(f, op)
+		byPath[fe.Path] = fe
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	// Files and subdirectories whose own removal was already reported are
+	// still being debounced; fold them into this directory.
+	for key, p := range w.pending {
+		if !strings.HasPrefix(key, dir.Path+string(filepath.Separator)) {
+			continue
+		}
+		p.timer.Stop()
+		delete(w.pending, key)
+		for _, c := range p.children {
+			byPath[c.Path] = c
+		}
+		if ev := merge(p.events); !ev.IsDir {
+			byPath[ev.Path] = ev
+		}
+	}
+	children := make([]types.FileEvent, 0, len(byPath))
+	for _, c := range byPath {
+		c.Dir = dir.Path
+		children = append(children, c)
+	}
+	sort.Slice(children, func(i, j int) bool { return children[i].Path < children[j].Path })
+	w.debounceLocked(dir, children)
+	return true
+}
+
+// event builds the event for a change to relPath, labelled with the root.
+func (w *Watcher) event(relPath string, op types.Operation) types.FileEvent {
 	fe := types.FileEvent{
 		Path:      relPath,
 		Op:        op,
 		Timestamp: time.Now(),
 	}
+	if w.config.Root != "" {
+		fe.Root = w.config.Root
+		fe.Path = filepath.Join(w.config.Root, relPath)
+	}
+	return fe
+}
 
-	w.debounce(fe)
+// handleError surfaces a backend error. An overflowing event queue means
+// changes were dropped, so the tree is rescanned to recover them.
+func (w *Watcher) handleError(err error) {
+	if !errors.Is(err, fsnotify.ErrEventOverflow) {
+		w.alert(w.config.Path, "watch error: "+err.Error())
+		return
+	}
+	if !w.rescanning.CompareAndSwap(false, true) {
+		return // a rescan is already underway and will see these changes
+	}
+	w.alert(w.config.Path, "event queue overflowed; rescanning for missed changes")
+	go func() {
+		defer w.rescanning.Store(false)
+		n := w.Rescan()
+		w.alert(w.config.Path, fmt.Sprintf("rescan found %d missed changes", n))
+	}()
+}
+
+// Rescan walks the tree, compares it against the index and emits the
+// creates, modifies and deletes that weren't seen as events, marked
+// Reconciled. It returns how many it found.
+func (w *Watcher) Rescan() int {
+	// Directories created while events were lost aren't watched yet; adding
+	// a watched directory again is harmless.
+	t, err := w.scan(func(dir string) error {
+		w.addDir(dir)
+		return nil
+	})
+	if err != nil {
+		return 0
+	}
+	current := t.files
+
+	w.indexMu.Lock()
+	previous := w.index
+	w.index, w.dirs, w.links = current, t.dirs, t.links
+	w.expanded = make(map[string]bool)
+	w.removedLinks = make(map[string]fileState)
+	w.indexMu.Unlock()
+
+	var missed []types.FileEvent
+	for relPath, s := range current {
+		old, ok := previous[relPath]
+		switch {
+		case !ok:
+			missed = append(missed, w.event(relPath, types.OpCreate))
+		case old != s:
+			fe := w.event(relPath, types.OpModify)
+			fe.Meta = metaChange(old, s)
+			if fe.Meta != nil && (old.sameContent(s) || old.isLink() && s.isLink()) {
+				fe.Op = types.OpMeta
+			}
+			missed = append(missed, fe)
+		}
+	}
+	for relPath := range previous {
+		if _, ok := current[relPath]; !ok {
+			missed = append(missed, w.event(relPath, types.OpDelete))
+		}
+	}
+	sort.Slice(missed, func(i, j int) bool { return missed[i].Path < missed[j].Path })
+	for _, fe := range missed {
+		fe.Reconciled = true
+		w.debounce(fe)
+	}
+	return len(missed)
+}
+
+func (w *Watcher) alert(path, msg string) {
+	if w.config.OnAlert != nil {
+		w.config.OnAlert(types.Alert{Time: time.Now(), Path: path, Message: msg})
+	}
 }
 
 func (w *Watcher) debounce(fe types.FileEvent) {
 	w.mu.Lock()
 	defer w.mu.Unlock()
+	w.debounceLocked(fe, nil)
+}
 
+// debounceLocked queues fe, along with children to send before it, and
+// restarts its path's debounce timer. w.mu must be held.
+func (w *Watcher) debounceLocked(fe types.FileEvent, children []types.FileEvent) {
 	key := fe.Path
 
 	if p, exists := w.pending[key]; exists {
 		p.events = append(p.events, fe)
+		p.children = append(p.children, children...)
 		p.timer.Reset(w.config.Debounce)
 		return
 	}
 
 	p := &pendingEvent{
-		events: []types.FileEvent{fe},
+		events:   []types.FileEvent{fe},
+		children: children,
 	}
 	p.timer = time.AfterFunc(w.config.Debounce, func() {
 		w.flush(key)
@@ -158,30 +684,183 @@ func (w *Watcher) flush(key string) {
 		return
 	}
 	delete(w.pending, key)
+	// Pausing and resuming flush what is pending, so everything here
+	// happened under the current state.
+	if w.paused {
+		for _, c := range p.children {
+			w.hold(c)
+		}
+		w.hold(merge(p.events))
+		w.mu.Unlock()
+		return
+	}
+	w.mu.Unlock()
+
+	for _, c := range p.children {
+		w.config.EventsChan <- c
+	}
+	w.config.EventsChan <- merge(p.events)
+}
+
+// takePending cuts debouncing short, returning every pending event in path
+// order, with the files of a removed directory before it. w.mu must be
+// held.
+func (w *Watcher) takePending() []types.FileEvent {
+	keys := make([]string, 0, len(w.pending))
+	for key, p := range w.pending {
+		p.timer.Stop() // a timer that already fired finds nothing to flush
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var events []types.FileEvent
+	for _, key := range keys {
+		p := w.pending[key]
+		delete(w.pending, key)
+		events = append(events, p.children...)
+		events = append(events, merge(p.events))
+	}
+	return events
+}
+
+// hold keeps fe until the watcher is resumed. w.mu must be held.
+func (w *Watcher) hold(fe types.FileEvent) {
+	if _, ok := w.held[fe.Path]; !ok {
+		w.order = append(w.order, fe.Path)
+	}
+	w.held[fe.Path] = append(w.held[fe.Path], fe)
+}
+
+// Pause stops the watcher sending events. Changes are still tracked, and
+// held until Resume. Changes still being debounced were made before the
+// pause and are sent right away.
+func (w *Watcher) Pause() {
+	w.mu.Lock()
+	if w.paused {
+		w.mu.Unlock()
+		return
+	}
+	before := w.takePending()
+	w.paused = true
+	w.held = make(map[string][]types.FileEvent)
+	w.order = nil
 	w.mu.Unlock()
 
-	last := p.events[len(p.events)-1]
+	for _, fe := range before {
+		w.config.EventsChan <- fe
+	}
+}
+
+// Paused reports whether the watcher is paused.
+func (w *Watcher) Paused() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.paused
+}
+
+// Resume starts sending events again, first sending one event marked
+// Paused for each path that changed while paused, including changes still
+// being debounced. Its operation is the net change since the pause; a file
+// that came and went is left out. The watcher stays paused until everything
+// held has been sent, so later changes can't overtake it.
+func (w *Watcher) Resume() {
+	for {
+		w.mu.Lock()
+		if !w.paused {
+			w.mu.Unlock()
+			return
+		}
+		for _, fe := range w.takePending() {
+			w.hold(fe)
+		}
+		held, order := w.held, w.order
+		if len(order) == 0 {
+			w.paused, w.held, w.order = false, nil, nil
+			w.mu.Unlock()
+			return
+		}
+		w.held, w.order = make(map[string][]types.FileEvent), nil
+		w.mu.Unlock()
+
+		w.sendHeld(held, order)
+	}
+}
+
+// sendHeld sends the changes held for each path in order as one event.
+func (w *Watcher) sendHeld(held map[string][]types.FileEvent, order []string) {
+	now := time.Now()
+	for _, path := range order {
+		events := held[path]
+		fe := merge(events)
+		fe.Paused = true
+		fe.Timestamp = now
+		if !fe.IsDir {
+			_, err := os.Lstat(filepath.Join(w.config.Path, w.relPath(path)))
+			switch {
+			case err != nil && events[0].Op == types.OpCreate:
+				continue
+			case err != nil:
+				fe.Op = types.OpDelete
+			case fe.Op == types.OpDelete:
+				fe.Op = types.OpModify
+			}
+		}
+		w.config.EventsChan <- fe
+	}
+}
+
+// relPath strips the root label from an event path.
+func (w *Watcher) relPath(path string) string {
+	if w.config.Root == "" {
+		return path
+	}
+	rel, _ := filepath.Rel(w.config.Root, path)
+	return rel
+}
+
+// merge folds a path's debounced events into one.
+func merge(events []types.FileEvent) types.FileEvent {
+	last := events[len(events)-1]
 
 	// Determine the effective operation: CREATE takes priority
-	// (e.g. CREATE + WRITE should remain CREATE)
+	// (e.g. CREATE + WRITE should remain CREATE), and a content change
+	// outweighs a metadata change.
 	op := last.Op
-	for _, ev := range p.events {
+	var meta *types.MetaChange
+	for _, ev := range events {
 		if ev.Op == types.OpCreate {
 			op = types.OpCreate
-			break
+		}
+		if ev.Op == types.OpModify && op == types.OpMeta {
+			op = types.OpModify
+		}
+		meta = mergeMeta(meta, ev.Meta)
+	}
+
+	// Only a change seen solely by a rescan counts as reconciled. A removed
+	// directory may be reported more than once, not always as a directory.
+	reconciled, isDir, dir := true, false, ""
+	for _, ev := range events {
+		reconciled = reconciled && ev.Reconciled
+		isDir = isDir || ev.IsDir
+		if ev.Dir != "" {
+			dir = ev.Dir
 		}
 	}
 
 	result := types.FileEvent{
-		Path:      last.Path,
-		Op:        op,
-		Timestamp: last.Timestamp,
+		Root:       last.Root,
+		Path:       last.Path,
+		Op:         op,
+		Timestamp:  last.Timestamp,
+		Reconciled: reconciled,
+		IsDir:      isDir,
+		Dir:        dir,
+		Meta:       meta,
 	}
-	if len(p.events) > 1 {
-		result.SubEvents = p.events
+	if len(events) > 1 {
+		result.SubEvents = events
 	}
-
-	w.config.EventsChan <- result
+	return result
 }
 
 func (w *Watcher) isFiltered(path string) bool {
@@ -198,6 +877,8 @@ func fsOpToType(op fsnotify.Op) types.Operation {
 		return types.OpDelete
 	case op.Has(fsnotify.Rename):
 		return types.OpRename
+	case op.Has(fsnotify.Chmod):
+		return types.OpMeta
 	default:
 		return -1
 	}
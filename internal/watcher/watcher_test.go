@@ -3,9 +3,14 @@ package watcher
 import (
 	"os"
 	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/fsnotify/fsnotify"
 	"github.com/wgawan/agent-spy/internal/types"
 )
 
@@ -146,3 +151,491 @@ func TestWatcherRecursive(t *testing.T) {
 		t.Fatal("timeout waiting for event in subdirectory")
 	}
 }
+
+func TestWatcherLabelsRoot(t *testing.T) {
+	dir := t.TempDir()
+	events := make(chan types.FileEvent, 10)
+
+	w, err := New(Config{
+		Path:       dir,
+		Root:       "svc",
+		EventsChan: events,
+		Debounce:   50 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	defer w.Close()
+	go w.Start()
+	time.Sleep(100 * time.Millisecond)
+
+	os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main"), 0644)
+
+	select {
+	case ev := <-events:
+		if ev.Root != "svc" || ev.Path != filepath.Join("svc", "main.go") {
+			t.Errorf("expected event labelled svc, got root=%q path=%q", ev.Root, ev.Path)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for event")
+	}
+}
+
+func TestWatcherRescansAfterOverflow(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "kept.go"), []byte("package kept"), 0644)
+	os.WriteFile(filepath.Join(dir, "edited.go"), []byte("package edited"), 0644)
+	os.WriteFile(filepath.Join(dir, "removed.go"), []byte("package removed"), 0644)
+
+	events := make(chan types.FileEvent, 10)
+	var alerts []types.Alert
+	var mu sync.Mutex
+	w, err := New(Config{
+		Path:       dir,
+		EventsChan: events,
+		Debounce:   20 * time.Millisecond,
+		// A poller that never fires stands in for a queue that dropped
+		// everything.
+		Backend:      BackendPoll,
+		PollInterval: time.Hour,
+		OnAlert: func(a types.Alert) {
+			mu.Lock()
+			alerts = append(alerts, a)
+			mu.Unlock()
+		},
+	})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	defer w.Close()
+
+	os.WriteFile(filepath.Join(dir, "edited.go"), []byte("package edited // changed"), 0644)
+	os.Remove(filepath.Join(dir, "removed.go"))
+	os.MkdirAll(filepath.Join(dir, "pkg"), 0755)
+	os.WriteFile(filepath.Join(dir, "pkg", "new.go"), []byte("package pkg"), 0644)
+
+	w.handleError(fsnotify.ErrEventOverflow)
+
+	got := map[string]types.Operation{}
+	for i := 0; i < 3; i++ {
+		select {
+		case ev := <-events:
+			if !ev.Reconciled {
+				t.Errorf("expected %s to be marked reconciled", ev.Path)
+			}
+			got[ev.Path] = ev.Op
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timeout waiting for reconciled events, got %v", got)
+		}
+	}
+	want := map[string]types.Operation{
+		"edited.go":                    types.OpModify,
+		"removed.go":                   types.OpDelete,
+		filepath.Join("pkg", "new.go"): types.OpCreate,
+	}
+	for path, op := range want {
+		if got[path] != op {
+			t.Errorf("%s: expected %v, got %v", path, op, got[path])
+		}
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		mu.Lock()
+		n := len(alerts)
+		mu.Unlock()
+		if n == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected overflow and rescan alerts, got %+v", alerts)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !strings.Contains(alerts[1].Message, "3 missed changes") {
+		t.Errorf("unexpected rescan alert %q", alerts[1].Message)
+	}
+}
+
+// collect gathers events until none arrive for quiet.
+func collect(events chan types.FileEvent, quiet time.Duration) []types.FileEvent {
+	var got []types.FileEvent
+	for {
+		select {
+		case ev := <-events:
+			got = append(got, ev)
+		case <-time.After(quiet):
+			return got
+		}
+	}
+}
+
+func TestWatcherExpandsDirectoryRemoval(t *testing.T) {
+	for _, backend := range []string{BackendNotify, BackendPoll} {
+		t.Run(backend, func(t *testing.T) {
+			dir := t.TempDir()
+			old := filepath.Join(dir, "pkg", "old")
+			os.MkdirAll(filepath.Join(old, "sub"), 0755)
+			os.WriteFile(filepath.Join(old, "a.go"), []byte("package old"), 0644)
+			os.WriteFile(filepath.Join(old, "sub", "b.go"), []byte("package sub"), 0644)
+
+			events := make(chan types.FileEvent, 20)
+			w, err := New(Config{
+				Path:         dir,
+				EventsChan:   events,
+				Debounce:     50 * time.Millisecond,
+				Backend:      backend,
+				PollInterval: 20 * time.Millisecond,
+			})
+			if err != nil {
+				t.Fatalf("New() error: %v", err)
+			}
+			defer w.Close()
+			go w.Start()
+			time.Sleep(100 * time.Millisecond)
+
+			os.RemoveAll(old)
+
+			got := collect(events, 300*time.Millisecond)
+			if len(got) == 0 {
+				t.Fatal("no events")
+			}
+			last := got[len(got)-1]
+			oldRel := filepath.Join("pkg", "old")
+			if !last.IsDir || last.Path != oldRel || last.Op != types.OpDelete {
+				t.Errorf("expected the directory event last, got %+v", last)
+			}
+			files := map[string]bool{}
+			for _, ev := range got[:len(got)-1] {
+				if ev.Dir != oldRel || ev.IsDir {
+					t.Errorf("expected a file event grouped under %s, got %+v", oldRel, ev)
+				}
+				files[ev.Path] = true
+			}
+			for _, f := range []string{filepath.Join(oldRel, "a.go"), filepath.Join(oldRel, "sub", "b.go")} {
+				if !files[f] {
+					t.Errorf("missing delete for %s in %+v", f, got)
+				}
+			}
+		})
+	}
+}
+
+func TestWatcherExpandsDirectoryMove(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "old"), 0755)
+	os.WriteFile(filepath.Join(dir, "old", "a.go"), []byte("package old"), 0644)
+
+	events := make(chan types.FileEvent, 20)
+	w, err := New(Config{Path: dir, EventsChan: events, Debounce: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	defer w.Close()
+	go w.Start()
+	time.Sleep(100 * time.Millisecond)
+
+	os.Rename(filepath.Join(dir, "old"), filepath.Join(dir, "new"))
+
+	// The old files and directory are renamed away, and the files show up
+	// again under the new name.
+	var moved []types.FileEvent
+	var created []string
+	for _, ev := range collect(events, 300*time.Millisecond) {
+		if ev.Op == types.OpCreate {
+			created = append(created, ev.Path)
+		} else {
+			moved = append(moved, ev)
+		}
+	}
+	if len(moved) != 2 {
+		t.Fatalf("expected a file and a directory event, got %+v", moved)
+	}
+	if moved[0].Path != filepath.Join("old", "a.go") || moved[0].Op != types.OpRename || moved[0].Dir != "old" {
+		t.Errorf("unexpected file event %+v", moved[0])
+	}
+	if moved[1].Path != "old" || !moved[1].IsDir || moved[1].Op != types.OpRename {
+		t.Errorf("unexpected directory event %+v", moved[1])
+	}
+	if len(created) != 1 || created[0] != filepath.Join("new", "a.go") {
+		t.Errorf("expected new/a.go to be created, got %v", created)
+	}
+
+	// The old watch is gone: writes under the new name aren't reported
+	// under the old one.
+	os.WriteFile(filepath.Join(dir, "new", "a.go"), []byte("package moved"), 0644)
+	for _, ev := range collect(events, 300*time.Millisecond) {
+		if strings.HasPrefix(ev.Path, "old") {
+			t.Errorf("stale watch reported %+v", ev)
+		}
+	}
+}
+
+func TestWatcherScansNewDirectories(t *testing.T) {
+	dir := t.TempDir()
+	events := make(chan types.FileEvent, 10)
+	w, err := New(Config{
+		Path:       dir,
+		EventsChan: events,
+		Debounce:   20 * time.Millisecond,
+		// Events are fed by hand below
+		Backend:      BackendPoll,
+		PollInterval: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	defer w.Close()
+
+	// mkdir -p a/b && write a/b/c.go, all before the watch on a exists
+	os.MkdirAll(filepath.Join(dir, "a", "b"), 0755)
+	os.WriteFile(filepath.Join(dir, "a", "b", "c.go"), []byte("package b"), 0644)
+	os.WriteFile(filepath.Join(dir, "a", "top.go"), []byte("package a"), 0644)
+
+	w.handleEvent(fsnotify.Event{Name: filepath.Join(dir, "a"), Op: fsnotify.Create})
+	// The create that raced the watch turns up anyway
+	w.handleEvent(fsnotify.Event{Name: filepath.Join(dir, "a", "top.go"), Op: fsnotify.Create})
+
+	got := collect(events, 200*time.Millisecond)
+	paths := map[string]int{}
+	for _, ev := range got {
+		if ev.Op != types.OpCreate {
+			t.Errorf("expected CREATE, got %+v", ev)
+		}
+		paths[ev.Path]++
+	}
+	want := map[string]int{filepath.Join("a", "b", "c.go"): 1, filepath.Join("a", "top.go"): 1}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("expected one create per file, got %v", paths)
+	}
+
+	// Later changes under the new directories are still reported.
+	os.WriteFile(filepath.Join(dir, "a", "b", "c.go"), []byte("package b // edited"), 0644)
+	w.handleEvent(fsnotify.Event{Name: filepath.Join(dir, "a", "b", "c.go"), Op: fsnotify.Write})
+	got = collect(events, 200*time.Millisecond)
+	if len(got) != 1 || got[0].Op != types.OpModify {
+		t.Errorf("expected a modify after the scan, got %+v", got)
+	}
+}
+
+func TestWatcherReportsMetadataChanges(t *testing.T) {
+	for _, backend := range []string{BackendNotify, BackendPoll} {
+		t.Run(backend, func(t *testing.T) {
+			dir := t.TempDir()
+			script := filepath.Join(dir, "deploy.sh")
+			link := filepath.Join(dir, "current")
+			os.WriteFile(script, []byte("#!/bin/sh\n"), 0644)
+			os.Symlink("v1", link)
+
+			events := make(chan types.FileEvent, 10)
+			w, err := New(Config{
+				Path:         dir,
+				EventsChan:   events,
+				Debounce:     50 * time.Millisecond,
+				Backend:      backend,
+				PollInterval: 20 * time.Millisecond,
+			})
+			if err != nil {
+				t.Fatalf("New() error: %v", err)
+			}
+			defer w.Close()
+			go w.Start()
+			time.Sleep(100 * time.Millisecond)
+
+			os.Chmod(script, 0755)
+			got := collect(events, 300*time.Millisecond)
+			want := &types.MetaChange{OldMode: "-rw-r--r--", NewMode: "-rwxr-xr-x"}
+			if len(got) != 1 || got[0].Op != types.OpMeta || !reflect.DeepEqual(got[0].Meta, want) {
+				t.Errorf("expected a mode change, got %+v", got)
+			}
+
+			// Timestamps alone aren't worth reporting. Polling can't tell a
+			// touch from a write, so it's only checked with fsnotify.
+			if backend == BackendNotify {
+				later := time.Now().Add(time.Hour)
+				os.Chtimes(script, later, later)
+				if got := collect(events, 300*time.Millisecond); len(got) != 0 {
+					t.Errorf("expected touch to be ignored, got %+v", got)
+				}
+			}
+
+			os.Remove(link)
+			os.Symlink("v2", link)
+			got = collect(events, 300*time.Millisecond)
+			want = &types.MetaChange{OldTarget: "v1", NewTarget: "v2"}
+			if len(got) != 1 || got[0].Path != "current" || got[0].Op != types.OpMeta || !reflect.DeepEqual(got[0].Meta, want) {
+				t.Errorf("expected the symlink to be repointed, got %+v", got)
+			}
+		})
+	}
+}
+
+func TestWatcherFollowsSymlinks(t *testing.T) {
+	dir := t.TempDir()
+	outside := t.TempDir()
+	os.WriteFile(filepath.Join(outside, "lib.go"), []byte("package lib"), 0644)
+	os.Symlink(outside, filepath.Join(dir, "shared"))
+	// Loops back into the tree, directly and through the followed target
+	os.Symlink(dir, filepath.Join(dir, "self"))
+	os.Symlink(dir, filepath.Join(outside, "back"))
+
+	events := make(chan types.FileEvent, 10)
+	w, err := New(Config{
+		Path:           dir,
+		EventsChan:     events,
+		Debounce:       50 * time.Millisecond,
+		FollowSymlinks: true,
+	})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	defer w.Close()
+	go w.Start()
+	time.Sleep(100 * time.Millisecond)
+
+	w.indexMu.Lock()
+	var dirs []string
+	for d := range w.dirs {
+		dirs = append(dirs, d)
+	}
+	w.indexMu.Unlock()
+	sort.Strings(dirs)
+	if want := []string{".", "shared"}; !reflect.DeepEqual(dirs, want) {
+		t.Errorf("expected watched dirs %v, got %v", want, dirs)
+	}
+
+	os.WriteFile(filepath.Join(outside, "lib.go"), []byte("package lib // edited"), 0644)
+	got := collect(events, 300*time.Millisecond)
+	if len(got) != 1 || got[0].Path != filepath.Join("shared", "lib.go") || got[0].Op != types.OpModify {
+		t.Errorf("expected a modify through the symlink, got %+v", got)
+	}
+}
+
+func TestWatcherHoldsEventsWhilePaused(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0644)
+	events := make(chan types.FileEvent, 10)
+	w, err := New(Config{
+		Path:       dir,
+		EventsChan: events,
+		Debounce:   20 * time.Millisecond,
+		// Events are fed by hand below
+		Backend:      BackendPoll,
+		PollInterval: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	defer w.Close()
+
+	w.Pause()
+	if !w.Paused() {
+		t.Fatal("expected the watcher to be paused")
+	}
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("mine"), 0644)
+	w.handleEvent(fsnotify.Event{Name: filepath.Join(dir, "a.txt"), Op: fsnotify.Write})
+	os.WriteFile(filepath.Join(dir, "b.txt"), []byte("b"), 0644)
+	w.handleEvent(fsnotify.Event{Name: filepath.Join(dir, "b.txt"), Op: fsnotify.Create})
+	os.WriteFile(filepath.Join(dir, "tmp.txt"), []byte("t"), 0644)
+	w.handleEvent(fsnotify.Event{Name: filepath.Join(dir, "tmp.txt"), Op: fsnotify.Create})
+	os.Remove(filepath.Join(dir, "tmp.txt"))
+	w.handleEvent(fsnotify.Event{Name: filepath.Join(dir, "tmp.txt"), Op: fsnotify.Remove})
+
+	if got := collect(events, 100*time.Millisecond); len(got) != 0 {
+		t.Fatalf("expected no events while paused, got %+v", got)
+	}
+
+	w.Resume()
+	got := collect(events, 100*time.Millisecond)
+	var ops []string
+	for _, ev := range got {
+		if !ev.Paused {
+			t.Errorf("expected a catch-up event, got %+v", ev)
+		}
+		ops = append(ops, ev.Path+" "+ev.Op.String())
+	}
+	sort.Strings(ops)
+	want := []string{"a.txt MODIFY", "b.txt CREATE"}
+	if !reflect.DeepEqual(ops, want) {
+		t.Errorf("expected %v, got %v", want, ops)
+	}
+
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("agent"), 0644)
+	w.handleEvent(fsnotify.Event{Name: filepath.Join(dir, "a.txt"), Op: fsnotify.Write})
+	if got := collect(events, 100*time.Millisecond); len(got) != 1 || got[0].Paused {
+		t.Errorf("expected a regular event after resuming, got %+v", got)
+	}
+}
+
+func TestWatcherPausesBetweenDebouncedEvents(t *testing.T) {
+	dir := t.TempDir()
+	events := make(chan types.FileEvent, 10)
+	w, err := New(Config{
+		Path:       dir,
+		EventsChan: events,
+		Debounce:   time.Hour, // only pausing and resuming flush
+		// Events are fed by hand below
+		Backend:      BackendPoll,
+		PollInterval: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	defer w.Close()
+
+	// The agent's change is still being debounced when capture is paused.
+	os.WriteFile(filepath.Join(dir, "agent.go"), []byte("package a"), 0644)
+	w.handleEvent(fsnotify.Event{Name: filepath.Join(dir, "agent.go"), Op: fsnotify.Create})
+	w.Pause()
+	got := collect(events, 50*time.Millisecond)
+	if len(got) != 1 || got[0].Path != "agent.go" || got[0].Paused {
+		t.Fatalf("expected the agent's change unmarked on pausing, got %+v", got)
+	}
+
+	// And the user's when it is resumed.
+	os.WriteFile(filepath.Join(dir, "mine.go"), []byte("package a"), 0644)
+	w.handleEvent(fsnotify.Event{Name: filepath.Join(dir, "mine.go"), Op: fsnotify.Create})
+	w.Resume()
+	got = collect(events, 50*time.Millisecond)
+	if len(got) != 1 || got[0].Path != "mine.go" || !got[0].Paused {
+		t.Fatalf("expected the user's change marked on resuming, got %+v", got)
+	}
+	if w.Paused() {
+		t.Error("expected the watcher to be resumed")
+	}
+}
+
+func TestWatcherIncludeOnly(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "src", "pkg"), 0755)
+	os.MkdirAll(filepath.Join(dir, "docs"), 0755)
+	os.MkdirAll(filepath.Join(dir, "vendor", "lib"), 0755)
+	os.WriteFile(filepath.Join(dir, "src", "pkg", "a.go"), []byte("package pkg"), 0644)
+	os.WriteFile(filepath.Join(dir, "src", "notes.txt"), []byte("notes"), 0644)
+	os.WriteFile(filepath.Join(dir, "vendor", "lib", "b.go"), []byte("package lib"), 0644)
+
+	w, err := New(Config{
+		Path:         dir,
+		EventsChan:   make(chan types.FileEvent, 10),
+		Include:      []string{"src/**/*.go", "vendor/**/*.go"},
+		Unfilter:     []string{"vendor/"},
+		Backend:      BackendPoll,
+		PollInterval: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	defer w.Close()
+
+	want := []string{filepath.Join("src", "pkg", "a.go"), filepath.Join("vendor", "lib", "b.go")}
+	if got := w.Files(); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected only included files, got %v", got)
+	}
+	if w.dirs["docs"] {
+		t.Error("expected docs not to be watched")
+	}
+
+	if _, err := New(Config{Path: dir, EventsChan: make(chan types.FileEvent), Unfilter: []string{"nope/"}}); err == nil {
+		t.Error("expected an error for an unfilter entry that lifts nothing")
+	}
+}
@@ -5,16 +5,25 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/wgawan/agent-spy/internal/api"
+	"github.com/wgawan/agent-spy/internal/bus"
+	"github.com/wgawan/agent-spy/internal/config"
+	"github.com/wgawan/agent-spy/internal/enrich"
 	gitpkg "github.com/wgawan/agent-spy/internal/git"
 	"github.com/wgawan/agent-spy/internal/logger"
+	"github.com/wgawan/agent-spy/internal/store"
+	"github.com/wgawan/agent-spy/internal/summary"
 	"github.com/wgawan/agent-spy/internal/tui"
 	"github.com/wgawan/agent-spy/internal/types"
 	"github.com/wgawan/agent-spy/internal/watcher"
 )
 
+const version = "0.1.0"
+
 type stringSlice []string
 
 func (s *stringSlice) String() string { return fmt.Sprintf("%v", *s) }
@@ -22,61 +31,164 @@ func (s *stringSlice) Set(v string) error {
 	*s = append(*s, v)
 	return nil
 }
+func (s *stringSlice) Get() interface{} { return []string(*s) }
 
 func main() {
-	version := flag.Bool("version", false, "print version")
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "export":
+			os.Exit(runExport(os.Args[2:]))
+		case "report":
+			os.Exit(runReport(os.Args[2:]))
+		}
+	}
+
+	showVersion := flag.Bool("version", false, "print version")
 	debounce := flag.Int("debounce", 500, "debounce interval in milliseconds")
 	logFile := flag.String("log", "", "write events to log file")
+	logFormat := flag.String("log-format", "text", "log file format: text or jsonl")
+	logPatch := flag.Bool("log-patch", false, "include each event's full unified diff in jsonl logs")
+	backend := flag.String("backend", "", "watcher backend: fsnotify or poll (default fsnotify, falling back to poll when out of inotify watches)")
+	pollInterval := flag.Duration("poll-interval", watcher.DefaultPollInterval, "how often the poll backend scans for changes")
+	pollHash := flag.Bool("poll-hash", false, "poll backend also hashes file contents, for filesystems with coarse mtimes")
+	followSymlinks := flag.Bool("follow-symlinks", false, "watch directories that symlinks point to, skipping loops")
+	baseline := flag.Bool("baseline", false, "record every file's content at startup, so its first change diffs against it (also diffs directories outside git)")
+	baselineMaxSize := flag.Int64("baseline-max-size", gitpkg.DefaultBaselineMaxSize, "files larger than this many bytes are left out of the baseline")
 	noGit := flag.Bool("no-git", false, "disable git integration")
-	var filters stringSlice
+	maxDiffSize := flag.Int64("max-diff-size", gitpkg.MaxDiffSize, "files larger than this many bytes are summarized by size and hash instead of diffed")
+	exportDir := flag.String("export-dir", "", "directory the e and s keys write patches and summaries to, outside the watched tree (default the system temp directory)")
+	summaryMD := flag.String("summary-md", "", "write a Markdown session summary to this file on exit")
+	checkpoint := flag.Duration("checkpoint", 0, "snapshot the working tree into refs/agent-spy/ after each quiet period of this length (e.g. 5s)")
+	changeSetGap := flag.Duration("change-set-gap", store.DefaultChangeSetGap, "group events with no quiet gap this long between them into change sets (0 disables)")
+	pauseCatchUp := flag.Bool("pause-catch-up", false, "after a pause, report each file changed while paused as one catch-up event instead of silently resyncing it")
+	listen := flag.String("listen", "", "serve the HTTP API on host:port or unix:/path/to.sock")
+	var filters, includes, unfilters stringSlice
 	flag.Var(&filters, "filter", "additional exclude patterns (can be specified multiple times)")
+	flag.Var(&includes, "include", "watch only files matching this glob, e.g. 'src/**/*.go' (can be specified multiple times)")
+	flag.Var(&unfilters, "unfilter", "stop filtering a default entry such as vendor/ or *.lock (can be specified multiple times)")
+	noDefaultFilters := flag.Bool("no-default-filters", false, "drop the built-in filters (node_modules/, build/, lock files, ...); .git is always filtered")
 	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage: agent-spy [flags] [path]\n\n")
+		fmt.Fprintf(os.Stderr, "Usage: agent-spy [flags] [path ...]\n")
+		fmt.Fprintf(os.Stderr, "       agent-spy export --patch --addr <addr> [flags]\n")
+		fmt.Fprintf(os.Stderr, "       agent-spy report <session.jsonl> [-o report.html]\n")
+		fmt.Fprintf(os.Stderr, "       agent-spy config show [flags]\n\n")
 		fmt.Fprintf(os.Stderr, "A live TUI for watching file changes in your project.\n\n")
 		fmt.Fprintf(os.Stderr, "Flags:\n")
 		flag.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nFlags can also be set in %s. %s in the current directory may set debounce,\nchange-set-gap, filter, log-format, log-patch, [keys] and [theme].\n", config.UserFile(), config.ProjectFile)
 	}
-	flag.Parse()
 
-	if *version {
-		fmt.Println("agent-spy v0.1.0")
-		os.Exit(0)
+	// `agent-spy config show [flags]` prints the settings the flags would
+	// run with instead of running.
+	args := os.Args[1:]
+	showConfig := len(args) > 0 && args[0] == "config"
+	if showConfig {
+		if len(args) < 2 || args[1] != "show" {
+			fmt.Fprintf(os.Stderr, "Usage: agent-spy config show [flags]\n")
+			os.Exit(2)
+		}
+		args = args[2:]
 	}
 
-	watchPath := "."
-	if flag.NArg() > 0 {
-		watchPath = flag.Arg(0)
+	// Configuration files set flag values before the command line does, so
+	// flags override them.
+	cfg, err := config.Load(config.UserFile(), config.ProjectFile)
+	if err == nil {
+		err = cfg.Apply(flag.CommandLine)
+	}
+	if err == nil {
+		err = tui.CheckKeys(config.Strings(cfg.Keys))
+	}
+	if err == nil {
+		err = tui.ApplyTheme(config.Strings(cfg.Theme))
 	}
-
-	absPath, err := filepath.Abs(watchPath)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error resolving path: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Error in configuration: %v\n", err)
 		os.Exit(1)
 	}
+	flag.CommandLine.Parse(args)
+	cfg.NoteFlags(flag.CommandLine, args)
 
-	// Verify path exists
-	info, err := os.Stat(absPath)
-	if err != nil || !info.IsDir() {
-		fmt.Fprintf(os.Stderr, "Error: %s is not a directory\n", absPath)
-		os.Exit(1)
+	if showConfig {
+		cfg.Show(os.Stdout, flag.CommandLine, tui.DefaultKeys, tui.DefaultTheme)
+		return
 	}
 
-	// Git setup
-	var repo *gitpkg.Repo
-	var gitBranch string
-	var gitAvailable bool
-	var diffFn func(string) (types.DiffResult, error)
+	if *showVersion {
+		fmt.Println("agent-spy v" + version)
+		os.Exit(0)
+	}
+
+	gitpkg.MaxDiffSize = *maxDiffSize
+
+	watchPaths := flag.Args()
+	if len(watchPaths) == 0 {
+		watchPaths = []string{"."}
+	}
+
+	var rs roots
+	var absPaths []string
+	for _, p := range watchPaths {
+		absPath, err := filepath.Abs(p)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error resolving path: %v\n", err)
+			os.Exit(1)
+		}
+		// Verify path exists
+		info, err := os.Stat(absPath)
+		if err != nil || !info.IsDir() {
+			fmt.Fprintf(os.Stderr, "Error: %s is not a directory\n", absPath)
+			os.Exit(1)
+		}
+		absPaths = append(absPaths, absPath)
+		rs = append(rs, &watchRoot{path: absPath})
+	}
+	if len(rs) > 1 {
+		for i, label := range rootLabels(absPaths) {
+			rs[i].label = label
+		}
+	}
+	absPath := strings.Join(absPaths, ", ")
 
+	// Git setup
 	if !*noGit {
-		repo, _ = gitpkg.Open(absPath)
-		if repo != nil && repo.Available() {
-			gitAvailable = true
-			gitBranch = repo.Branch()
-			diffFn = repo.Diff
+		for _, r := range rs {
+			if repo, _ := gitpkg.Open(r.path); repo != nil && repo.Available() {
+				r.repo = repo
+			}
 		}
 	}
+	if *baseline {
+		for _, r := range rs {
+			if r.repo == nil {
+				r.plain = gitpkg.OpenDir(r.path)
+			}
+		}
+	}
+	// A single root keeps its repository at hand; several are reached
+	// through rs.
+	var repo *gitpkg.Repo
+	var gitBranch string
+	if len(rs) == 1 && rs[0].repo != nil {
+		repo = rs[0].repo
+		gitBranch = repo.Branch()
+	}
+	gitAvailable := rs.gitAvailable()
+	var sessionPatch func(func(string) bool) (string, error)
+	if gitAvailable {
+		sessionPatch = rs.sessionPatch
+	}
 
 	// Set up log file if requested
+	format, err := logger.ParseFormat(*logFormat)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if *logPatch && format != logger.FormatJSONL {
+		fmt.Fprintf(os.Stderr, "Error: -log-patch requires -log-format jsonl\n")
+		os.Exit(1)
+	}
 	var logWriter *os.File
 	if *logFile != "" {
 		logWriter, err = os.OpenFile(*logFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
@@ -90,60 +202,266 @@ func main() {
 	// Create event channel
 	events := make(chan types.FileEvent, 100)
 
-	// Set up file watcher
-	var extraFilters []string
-	if gitAvailable {
-		extraFilters = repo.IgnorePatterns()
+	st := store.New()
+	st.SetChangeSetGap(*changeSetGap)
+	if len(cfg.Project) > 0 {
+		// The agent can write the project file, so say what it changed.
+		st.AddAlert(types.Alert{
+			Path:    config.ProjectFile,
+			Message: "settings from " + config.ProjectFile + ": " + strings.Join(cfg.Project, "; "),
+		})
 	}
-	extraFilters = append(extraFilters, filters...)
+	b := bus.New()
 
-	w, err := watcher.New(watcher.Config{
-		Path:       absPath,
-		EventsChan: events,
-		Debounce:   time.Duration(*debounce) * time.Millisecond,
-		Filters:    extraFilters,
-	})
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error starting watcher: %v\n", err)
-		os.Exit(1)
-	}
-	defer w.Close()
+	// Set up a file watcher per root
+	var polling bool
+	started := time.Now()
+	for _, r := range rs {
+		var extraFilters []string
+		if r.repo != nil {
+			extraFilters = r.repo.IgnorePatterns()
+		}
+		extraFilters = append(extraFilters, filters...)
+
+		w, err := watcher.New(watcher.Config{
+			Path:             r.path,
+			Root:             r.label,
+			EventsChan:       events,
+			Debounce:         time.Duration(*debounce) * time.Millisecond,
+			Filters:          extraFilters,
+			Include:          includes,
+			Unfilter:         unfilters,
+			NoDefaultFilters: *noDefaultFilters,
+			Backend:          *backend,
+			PollInterval:     *pollInterval,
+			PollHash:         *pollHash,
+			FollowSymlinks:   *followSymlinks,
+			OnAlert:          st.AddAlert,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error starting watcher: %v\n", err)
+			os.Exit(1)
+		}
+		defer w.Close()
+		r.watcher = w
+		if *baseline {
+			go r.differ().LoadBaseline(w.Files(), *baselineMaxSize, started)
+		}
+		polling = polling || w.Backend() == watcher.BackendPoll
+		if *backend == "" && w.Backend() == watcher.BackendPoll {
+			st.AddAlert(types.Alert{
+				Path:    r.path,
+				Message: fmt.Sprintf("out of inotify watches; polling every %s instead", *pollInterval),
+			})
+		}
 
-	go w.Start()
+		go w.Start()
 
-	// If logging, wrap the events channel
+		// .git is filtered from the watcher above; git operations are
+		// reported separately so the file changes they cause can be explained.
+		if r.repo != nil {
+			ops, err := r.repo.WatchOps(events)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error watching git operations: %v\n", err)
+				os.Exit(1)
+			}
+			ops.Root = r.label
+			defer ops.Close()
+			go ops.Start()
+		}
+	}
+
+	var logDone chan struct{}
 	if logWriter != nil {
 		l := logger.New(logWriter)
-		loggedEvents := make(chan types.FileEvent, 100)
+		if format == logger.FormatJSONL {
+			l = logger.NewJSONL(logWriter, *logPatch)
+		}
+		session := logger.SessionEntry{
+			Time:      time.Now(),
+			WatchPath: absPath,
+			GitBranch: gitBranch,
+			Version:   version,
+			Flags:     map[string]string{},
+		}
+		if repo != nil {
+			session.GitHead = repo.Head()
+		}
+		if len(rs) > 1 {
+			session.Roots = make(map[string]string)
+			for _, r := range rs {
+				session.Roots[r.label] = r.path
+			}
+		}
+		flag.VisitAll(func(f *flag.Flag) {
+			session.Flags[f.Name] = f.Value.String()
+		})
+		l.LogSession(session)
+
+		sub := b.Subscribe("log", 1024, bus.Block)
+		logDone = make(chan struct{})
 		go func() {
-			for ev := range events {
-				var stats *types.DiffStats
-				if diffFn != nil {
-					diff, _ := diffFn(ev.Path)
-					if diff.Available {
-						stats = &diff.Stats
-					}
+			defer close(logDone)
+			for rec := range sub.C() {
+				if rec.Pending {
+					continue
 				}
-				l.LogEvent(ev, stats)
-				loggedEvents <- ev
+				l.LogRecord(rec)
 			}
 		}()
-		events = loggedEvents
 	}
 
-	// Display path relative to home for nicer display
-	displayPath := absPath
-	if home, err := os.UserHomeDir(); err == nil {
-		if rel, err := filepath.Rel(home, absPath); err == nil {
-			displayPath = "~/" + rel
+	// Display paths relative to home for nicer display
+	var display []string
+	for _, p := range absPaths {
+		if home, err := os.UserHomeDir(); err == nil {
+			if rel, err := filepath.Rel(home, p); err == nil {
+				p = "~/" + rel
+			}
+		}
+		display = append(display, p)
+	}
+	displayPath := strings.Join(display, ", ")
+
+	if *listen != "" {
+		ln, err := api.Listen(*listen)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error starting API server: %v\n", err)
+			os.Exit(1)
+		}
+		cfg := api.Config{
+			Store:     st,
+			Bus:       b,
+			WatchPath: absPath,
+			GitBranch: gitBranch,
+			Patch:     sessionPatch,
+			Pause:     rs,
+		}
+		if repo != nil {
+			cfg.Branch = repo.Branch
+		}
+		srv := api.New(cfg)
+		go srv.Serve(ln)
+		defer srv.Close()
+	}
+
+	// Files written on request go outside the watched tree by default, so
+	// they aren't recorded as changes of the session they describe.
+	outDir := *exportDir
+	if outDir == "" {
+		outDir = os.TempDir()
+	}
+
+	writeSummary := func() (string, error) {
+		name := *summaryMD
+		if name == "" {
+			name = filepath.Join(outDir, "agent-spy-"+time.Now().Format("20060102-150405")+"-summary.md")
+		}
+		info := summary.Info{WatchPath: displayPath, GitBranch: gitBranch}
+		if repo != nil {
+			info.GitBranch = repo.Branch()
+		}
+		return name, writeSummaryFile(name, st, info)
+	}
+
+	var checkpoints tui.Checkpoints
+	var checkpointDone chan struct{}
+	if *checkpoint > 0 {
+		if repo == nil {
+			fmt.Fprintf(os.Stderr, "Error: -checkpoint requires a single git repository\n")
+			os.Exit(1)
+		}
+		cp, err := gitpkg.NewCheckpointer(repo, gitpkg.CheckpointConfig{
+			Quiet: *checkpoint,
+			OnError: func(err error) {
+				st.AddAlert(types.Alert{Message: "checkpoint failed: " + err.Error()})
+			},
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
 		}
+		checkpoints = cp
+		sub := b.Subscribe("checkpoint", 1024, bus.Block)
+		checkpointDone = make(chan struct{})
+		go func() {
+			defer close(checkpointDone)
+			cp.Run(sub.C())
+		}()
 	}
 
+	tuiSub := b.Subscribe("tui", 1024, bus.Block)
+
+	// Subscribers are in place; start turning events into records.
+	enricher := enrich.New(rs.differ(), st, b)
+	enricher.SetCatchUp(*pauseCatchUp)
+	go enricher.Run(events)
+	notifyPause(rs)
+
 	// Start TUI
-	model := tui.New(events, displayPath, gitBranch, gitAvailable, diffFn)
-	p := tea.NewProgram(model, tea.WithAltScreen())
-	if _, err := p.Run(); err != nil {
+	tuiConfig := tui.Config{
+		Records:      tuiSub.C(),
+		Bus:          b,
+		Store:        st,
+		WatchPath:    displayPath,
+		GitBranch:    gitBranch,
+		GitAvailable: gitAvailable,
+		Polling:      polling,
+		ExportPatch:  sessionPatch,
+		ExportDir:    outDir,
+		WriteSummary: writeSummary,
+		Checkpoints:  checkpoints,
+		Pause:        rs,
+		Keys:         config.Strings(cfg.Keys),
+	}
+	if *baseline {
+		tuiConfig.Baseline = rs.baselineProgress
+	}
+	if gitAvailable {
+		tuiConfig.GitStatus = rs.status
+		tuiConfig.DiffAgainst = rs.diffAgainst
+	}
+	if len(rs) > 1 {
+		for _, r := range rs {
+			root := tui.Root{Label: r.label}
+			if r.repo != nil {
+				root.Branch = r.repo.Branch()
+			}
+			tuiConfig.Roots = append(tuiConfig.Roots, root)
+		}
+	}
+	p := tea.NewProgram(tui.New(tuiConfig), tea.WithAltScreen())
+	_, err = p.Run()
+
+	// Stop feeding the TUI, then let the remaining consumers drain.
+	tuiSub.Close()
+	b.Close()
+	if logDone != nil {
+		<-logDone
+	}
+	if checkpointDone != nil {
+		<-checkpointDone
+	}
+	if *summaryMD != "" {
+		if _, serr := writeSummary(); serr != nil {
+			fmt.Fprintf(os.Stderr, "Error writing summary: %v\n", serr)
+		}
+	}
+
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 }
+
+func writeSummaryFile(name string, st *store.Store, info summary.Info) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := summary.Write(f, st, info); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/wgawan/agent-spy/internal/report"
+)
+
+// runReport implements `agent-spy report`, which renders a recorded session
+// log as a self-contained HTML page.
+func runReport(args []string) int {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	output := fs.String("o", "", "output file (default: the log name with .html)")
+	session := fs.Int("session", 0, "which session in the log to report, counting from 1 (default: the last)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: agent-spy report <session.jsonl|session.aspy> [-o report.html]\n\n")
+		fmt.Fprintf(os.Stderr, "Render a session recorded with -log-format jsonl as an HTML report.\n")
+		fmt.Fprintf(os.Stderr, "Record with -log-patch to include per-file diffs.\n\n")
+		fmt.Fprintf(os.Stderr, "Flags:\n")
+		fs.PrintDefaults()
+	}
+	// Allow flags on either side of the input file.
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+	input := fs.Arg(0)
+	fs.Parse(fs.Args()[1:])
+
+	f, err := os.Open(input)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	defer f.Close()
+
+	sessions, err := report.Load(f)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", input, err)
+		return 1
+	}
+	if len(sessions) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: %s contains no sessions\n", input)
+		return 1
+	}
+	idx := len(sessions) - 1
+	if *session != 0 {
+		if *session < 1 || *session > len(sessions) {
+			fmt.Fprintf(os.Stderr, "Error: %s has %d session(s)\n", input, len(sessions))
+			return 2
+		}
+		idx = *session - 1
+	}
+
+	out := *output
+	if out == "" {
+		out = strings.TrimSuffix(input, filepath.Ext(input)) + ".html"
+	}
+	w, err := os.Create(out)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	defer w.Close()
+	if err := report.WriteHTML(w, sessions[idx]); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing report: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "Report written to %s\n", out)
+	return 0
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/wgawan/agent-spy/internal/enrich"
+	gitpkg "github.com/wgawan/agent-spy/internal/git"
+	"github.com/wgawan/agent-spy/internal/types"
+	"github.com/wgawan/agent-spy/internal/watcher"
+)
+
+// watchRoot is one directory given on the command line.
+type watchRoot struct {
+	label string       // prefix for its events; "" when it is the only root
+	path  string       // absolute
+	repo  *gitpkg.Repo // nil without git
+	// plain diffs a root outside git against its baseline; nil without
+	// --baseline or with git.
+	plain *gitpkg.Repo
+
+	watcher *watcher.Watcher
+}
+
+// differ returns the repository r's files are diffed with, or nil.
+func (r *watchRoot) differ() *gitpkg.Repo {
+	if r.repo != nil {
+		return r.repo
+	}
+	return r.plain
+}
+
+// roots are the directories watched in a session. With several roots every
+// event path starts with its root's label.
+type roots []*watchRoot
+
+// rootLabels names each root after its directory, numbering repeats.
+func rootLabels(paths []string) []string {
+	labels := make([]string, len(paths))
+	seen := make(map[string]int)
+	for i, p := range paths {
+		base := filepath.Base(p)
+		seen[base]++
+		labels[i] = base
+		if n := seen[base]; n > 1 {
+			labels[i] = fmt.Sprintf("%s-%d", base, n)
+		}
+	}
+	return labels
+}
+
+// find returns the root a labelled path belongs to and the path within it.
+func (rs roots) find(path string) (*watchRoot, string) {
+	if len(rs) == 1 {
+		return rs[0], path
+	}
+	label, rel, _ := strings.Cut(filepath.ToSlash(path), "/")
+	for _, r := range rs {
+		if r.label == label {
+			return r, filepath.FromSlash(rel)
+		}
+	}
+	return nil, path
+}
+
+func (rs roots) gitAvailable() bool {
+	for _, r := range rs {
+		if r.repo != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Paused reports whether event capture is paused.
+func (rs roots) Paused() bool {
+	for _, r := range rs {
+		if r.watcher != nil && r.watcher.Paused() {
+			return true
+		}
+	}
+	return false
+}
+
+// SetPaused pauses or resumes every root's watcher.
+func (rs roots) SetPaused(paused bool) {
+	for _, r := range rs {
+		if r.watcher == nil {
+			continue
+		}
+		if paused {
+			r.watcher.Pause()
+		} else {
+			r.watcher.Resume()
+		}
+	}
+}
+
+// differ returns what the enricher diffs with, or nil when no root can be
+// diffed.
+func (rs roots) differ() enrich.Differ {
+	if len(rs) == 1 {
+		if d := rs[0].differ(); d != nil {
+			return d
+		}
+		return nil
+	}
+	rd := enrich.RootDiffer{}
+	for _, r := range rs {
+		if d := r.differ(); d != nil {
+			rd[r.label] = d
+		}
+	}
+	if len(rd) == 0 {
+		return nil
+	}
+	return rd
+}
+
+// baselineProgress sums how many files have been read into the roots'
+// baselines, out of how many.
+func (rs roots) baselineProgress() (done, total int) {
+	for _, r := range rs {
+		if d := r.differ(); d != nil {
+			n, t := d.BaselineProgress()
+			done += n
+			total += t
+		}
+	}
+	return done, total
+}
+
+// status merges git status across roots, keyed by labelled path.
+func (rs roots) status() (map[string]gitpkg.FileStatus, error) {
+	if len(rs) == 1 {
+		return rs[0].repo.Status()
+	}
+	status := make(map[string]gitpkg.FileStatus)
+	for _, r := range rs {
+		if r.repo == nil {
+			continue
+		}
+		st, err := r.repo.Status()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", r.label, err)
+		}
+		for path, s := range st {
+			status[filepath.Join(r.label, path)] = s
+		}
+	}
+	return status, nil
+}
+
+func (rs roots) diffAgainst(path string, base gitpkg.DiffBase) (types.DiffResult, error) {
+	r, rel := rs.find(path)
+	if r == nil || r.repo == nil {
+		return types.DiffResult{Available: false, Error: "not a git repository"}, nil
+	}
+	return r.repo.DiffAgainst(rel, base)
+}
+
+// sessionPatch builds the session patch. Each repository's patch applies
+// from its own worktree root, so changes spanning several roots can't be
+// exported as one patch.
+func (rs roots) sessionPatch(include func(string) bool) (string, error) {
+	if len(rs) == 1 {
+		return rs[0].repo.SessionPatch(include)
+	}
+	var patch, from string
+	for _, r := range rs {
+		if r.repo == nil {
+			continue
+		}
+		label := r.label
+		p, err := r.repo.SessionPatch(func(path string) bool {
+			return include == nil || include(filepath.Join(label, path))
+		})
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", label, err)
+		}
+		if p == "" {
+			continue
+		}
+		if patch != "" {
+			return "", fmt.Errorf("changes span %s and %s; filter to one root (R) to export", from, label)
+		}
+		patch, from = p, label
+	}
+	return patch, nil
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRootLabels(t *testing.T) {
+	got := rootLabels([]string{"/src/svc", "/src/lib", "/vendor/lib"})
+	want := []string{"svc", "lib", "lib-2"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("rootLabels = %v, want %v", got, want)
+	}
+}
+
+func TestRootsFind(t *testing.T) {
+	rs := roots{{label: "svc", path: "/src/svc"}, {label: "lib", path: "/src/lib"}}
+
+	r, rel := rs.find(filepath.Join("lib", "pkg", "util.go"))
+	if r != rs[1] || rel != filepath.Join("pkg", "util.go") {
+		t.Errorf("find = %v, %q", r, rel)
+	}
+	if r, _ := rs.find("other/x.go"); r != nil {
+		t.Errorf("expected no root for an unknown label, got %v", r)
+	}
+
+	single := roots{{path: "/src/svc"}}
+	if r, rel := single.find("main.go"); r != single[0] || rel != "main.go" {
+		t.Errorf("single root find = %v, %q", r, rel)
+	}
+}
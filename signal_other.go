@@ -0,0 +1,6 @@
+//go:build !unix
+
+package main
+
+// notifyPause is a no-op where SIGUSR1 doesn't exist.
+func notifyPause(rs roots) {}
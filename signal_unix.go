@@ -0,0 +1,21 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifyPause toggles event capture on SIGUSR1, so a script can pause
+// recording around edits of its own with `kill -USR1`.
+func notifyPause(rs roots) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGUSR1)
+	go func() {
+		for range sigs {
+			rs.SetPaused(!rs.Paused())
+		}
+	}()
+}